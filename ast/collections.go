@@ -0,0 +1,59 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hxkhan/evie/token"
+)
+
+type Array struct {
+	token.Pos
+	Elements []Node
+}
+
+type Map struct {
+	token.Pos
+	Keys   []string
+	Values []Node
+}
+
+type Index struct {
+	token.Pos
+	Lhs   Node // [required]
+	Index Node // [required]
+}
+
+func (node Array) String() string {
+	b := strings.Builder{}
+	b.WriteByte('[')
+
+	for i, elem := range node.Elements {
+		b.WriteString(fmt.Sprint(elem))
+		if i != len(node.Elements)-1 {
+			b.WriteString(", ")
+		}
+	}
+
+	b.WriteByte(']')
+	return b.String()
+}
+
+func (node Map) String() string {
+	b := strings.Builder{}
+	b.WriteByte('{')
+
+	for i, key := range node.Keys {
+		b.WriteString(fmt.Sprintf("%q: %v", key, node.Values[i]))
+		if i != len(node.Keys)-1 {
+			b.WriteString(", ")
+		}
+	}
+
+	b.WriteByte('}')
+	return b.String()
+}
+
+func (node Index) String() string {
+	return fmt.Sprintf("%v[%v]", node.Lhs, node.Index)
+}
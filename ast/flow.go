@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/hxkhan/evie/token"
 )
@@ -19,6 +20,60 @@ type While struct {
 	Action    Node // [required]
 }
 
+type Switch struct {
+	token.Pos
+	Tag     Node   // [optional] nil means every case is a condition
+	Cases   []Case // [required]
+	Default Node   // [optional]
+}
+
+// Select waits for whichever task in its cases finishes first
+type Select struct {
+	token.Pos
+	Name    string // [optional] name bound to the result of the finished task
+	Cases   []Case // [required] values are the tasks to wait on
+	Default Node   // [optional] runs right away if no task has finished yet
+}
+
+type Case struct {
+	token.Pos
+	Values []Node // [required]
+	Action Node   // [required]
+}
+
+type For struct {
+	token.Pos
+	Key      string // [optional] name bound to the index or key
+	Value    string // [required] name bound to the element
+	Iterable Node   // [required]
+	Action   Node   // [required]
+}
+
+// Range is a numeric range like 0..10 where the end is excluded
+type Range struct {
+	token.Pos
+	Start Node // [required]
+	End   Node // [required]
+}
+
+type Try struct {
+	token.Pos
+	Action  Node   // [required]
+	Name    string // [optional] name bound to the caught error
+	Handler Node   // [required]
+}
+
+type Throw struct {
+	token.Pos
+	Value Node // [required]
+}
+
+// Catch turns an exception raised by Value into an error value
+type Catch struct {
+	token.Pos
+	Value Node // [required]
+}
+
 type Unsynced struct {
 	token.Pos
 	Action Node // [required]
@@ -29,6 +84,12 @@ type Synced struct {
 	Action Node // [required]
 }
 
+// Nursery waits for every task spawned inside of it and cancels them all once one fails
+type Nursery struct {
+	token.Pos
+	Action Node // [required]
+}
+
 type Continue struct {
 	token.Pos
 }
@@ -50,6 +111,80 @@ func (node While) String() string {
 	return fmt.Sprintf("while (%v) %v", node.Condition, node.Action)
 }
 
+func (node Switch) String() string {
+	b := strings.Builder{}
+	b.WriteString("switch ")
+	if node.Tag != nil {
+		b.WriteString(fmt.Sprint(node.Tag))
+		b.WriteByte(' ')
+	}
+	writeCases(&b, node.Cases, node.Default)
+	return b.String()
+}
+
+func (node Select) String() string {
+	b := strings.Builder{}
+	b.WriteString("switch ")
+	if node.Name != "" {
+		b.WriteString(node.Name)
+		b.WriteString(" := ")
+	}
+	b.WriteString("await ")
+	writeCases(&b, node.Cases, node.Default)
+	return b.String()
+}
+
+func writeCases(b *strings.Builder, cases []Case, def Node) {
+	b.WriteString("{\n")
+
+	for _, c := range cases {
+		b.WriteString("case ")
+		for i, v := range c.Values {
+			b.WriteString(fmt.Sprint(v))
+			if i != len(c.Values)-1 {
+				b.WriteString(", ")
+			}
+		}
+		b.WriteString(fmt.Sprintf(": %v", c.Action))
+	}
+
+	if def != nil {
+		b.WriteString(fmt.Sprintf("default: %v", def))
+	}
+
+	b.WriteByte('}')
+}
+
+func (node For) String() string {
+	if node.Key != "" {
+		return fmt.Sprintf("for %v, %v := %v %v", node.Key, node.Value, node.Iterable, node.Action)
+	}
+	return fmt.Sprintf("for %v := %v %v", node.Value, node.Iterable, node.Action)
+}
+
+func (node Range) String() string {
+	return fmt.Sprintf("%v..%v", node.Start, node.End)
+}
+
+func (node Try) String() string {
+	if node.Name != "" {
+		return fmt.Sprintf("try %v catch %v %v", node.Action, node.Name, node.Handler)
+	}
+	return fmt.Sprintf("try %v catch %v", node.Action, node.Handler)
+}
+
+func (node Throw) String() string {
+	return fmt.Sprintf("throw %v", node.Value)
+}
+
+func (node Catch) String() string {
+	return fmt.Sprintf("catch => %v", node.Value)
+}
+
+func (node Nursery) String() string {
+	return fmt.Sprintf("nursery %v", node.Action)
+}
+
 func (node Continue) String() string {
 	return "continue"
 }
@@ -22,12 +22,16 @@ const (
 
 type Fn struct {
 	token.Pos
-	Name       string
-	Args       []string
-	SyncMode   SyncMode
-	Action     Node
-	IsPublic   bool
-	UsedAsExpr bool
+	Name        string
+	Args        []string
+	Defaults    []Node // values of the last len(Defaults) args when they are not given
+	Rest        string // [optional] name bound to an array of the extra arguments
+	Receiver    string // [optional] the type this is a method of, the first arg is bound to the receiver
+	SyncMode    SyncMode
+	Action      Node
+	IsPublic    bool
+	UsedAsExpr  bool
+	IsGenerator bool // the body yields, so calling it gives back a generator
 }
 
 type Go struct {
@@ -41,6 +45,24 @@ type Call struct {
 	Args []Node
 }
 
+// Spread passes the elements of an array as separate arguments
+type Spread struct {
+	token.Pos
+	Value Node
+}
+
+// Defer runs a call once the function it is in exits, the callee & arguments are evaluated right away
+type Defer struct {
+	token.Pos
+	Call Call
+}
+
+// Yield hands a value to whoever pulls from the generator & waits for the next pull
+type Yield struct {
+	token.Pos
+	Value Node
+}
+
 type Return struct {
 	token.Pos
 	Value Node
@@ -73,8 +95,22 @@ type FieldAccess struct {
 
 func (fn Fn) String() string {
 	b := strings.Builder{}
+	if fn.IsPublic {
+		b.WriteString("pub ")
+	}
 	b.WriteString("fn")
 
+	// receiver
+	first := 0
+	if fn.Receiver != "" {
+		b.WriteString(" (")
+		b.WriteString(fn.Args[0])
+		b.WriteByte(' ')
+		b.WriteString(fn.Receiver)
+		b.WriteByte(')')
+		first = 1
+	}
+
 	if fn.Name != "" {
 		b.WriteByte(' ')
 		b.WriteString(fn.Name)
@@ -82,12 +118,25 @@ func (fn Fn) String() string {
 
 	// args
 	b.WriteByte('(')
-	for i, name := range fn.Args {
+	optional := len(fn.Args) - len(fn.Defaults)
+	for i := first; i < len(fn.Args); i++ {
+		name := fn.Args[i]
 		b.WriteString(name)
+		if i >= optional {
+			b.WriteString(" = ")
+			b.WriteString(fmt.Sprint(fn.Defaults[i-optional]))
+		}
 		if i != len(fn.Args)-1 {
 			b.WriteByte(',')
 		}
 	}
+	if fn.Rest != "" {
+		if len(fn.Args) > first {
+			b.WriteByte(',')
+		}
+		b.WriteString("...")
+		b.WriteString(fn.Rest)
+	}
 	b.WriteByte(')')
 
 	b.WriteString(fmt.Sprint(fn.Action))
@@ -111,6 +160,18 @@ func (call Call) String() string {
 	return b.String()
 }
 
+func (node Spread) String() string {
+	return fmt.Sprintf("...%v", node.Value)
+}
+
+func (node Defer) String() string {
+	return fmt.Sprintf("defer %v", node.Call)
+}
+
+func (node Yield) String() string {
+	return fmt.Sprintf("yield %v", node.Value)
+}
+
 func (ret Return) String() string {
 	return fmt.Sprintf("return %v", ret.Value)
 }
@@ -20,7 +20,7 @@ type Package struct {
 }
 
 type Literal interface {
-	bool | float64 | string | struct{}
+	bool | int64 | float64 | string | struct{}
 }
 
 type Input[T Literal] struct {
@@ -124,6 +124,23 @@ func IsCallFree(node Node) bool {
 
 	case BinOp:
 		return IsCallFree(node.Lhs) && IsCallFree(node.Rhs)
+
+	case Array:
+		for _, elem := range node.Elements {
+			if !IsCallFree(elem) {
+				return false
+			}
+		}
+
+	case Map:
+		for _, value := range node.Values {
+			if !IsCallFree(value) {
+				return false
+			}
+		}
+
+	case Index:
+		return IsCallFree(node.Lhs) && IsCallFree(node.Index)
 	}
 
 	return true
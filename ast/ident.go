@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/hxkhan/evie/token"
 )
@@ -11,6 +12,34 @@ type Decl struct {
 	Name     string
 	Value    Node
 	IsStatic bool
+	IsPublic bool
+}
+
+// Destructure binds the parts of a value to several names e.g. x, y := f(), [first, ...rest] := arr or {name, age} := user
+type Destructure struct {
+	token.Pos
+	Names    []string // names bound in order, '_' skips a part
+	Rest     string   // [optional] name bound to the remaining elements or entries
+	FromMap  bool     // names are keys of a map instead of positions in an array
+	Value    Node
+	IsStatic bool
+	IsPublic bool
+}
+
+// Type declares a record type e.g. type Point { x, y }
+type Type struct {
+	token.Pos
+	Name     string
+	Fields   []string
+	IsPublic bool
+}
+
+// Enum declares a set of named constants e.g. enum Status { Active, Deleted }
+type Enum struct {
+	token.Pos
+	Name     string
+	Members  []string
+	IsPublic bool
 }
 
 type Ident struct {
@@ -29,8 +58,54 @@ func (node Ident) String() string {
 }
 
 func (node Decl) String() string {
+	prefix := ""
+	if node.IsPublic {
+		prefix = "pub "
+	}
+
+	if node.IsStatic {
+		return fmt.Sprintf("%s%s := %v", prefix, node.Name, node.Value)
+	}
+	return fmt.Sprintf("%svar %s := %v", prefix, node.Name, node.Value)
+}
+
+func (node Type) String() string {
+	prefix := ""
+	if node.IsPublic {
+		prefix = "pub "
+	}
+	return fmt.Sprintf("%stype %s { %s }", prefix, node.Name, strings.Join(node.Fields, ", "))
+}
+
+func (node Enum) String() string {
+	prefix := ""
+	if node.IsPublic {
+		prefix = "pub "
+	}
+	return fmt.Sprintf("%senum %s { %s }", prefix, node.Name, strings.Join(node.Members, ", "))
+}
+
+// Pattern returns the left-hand side e.g. [first, ...rest]
+func (node Destructure) Pattern() string {
+	names := node.Names
+	if node.Rest != "" {
+		names = append(names[:len(names):len(names)], "..."+node.Rest)
+	}
+
+	if node.FromMap {
+		return fmt.Sprintf("{%v}", strings.Join(names, ", "))
+	}
+	return fmt.Sprintf("[%v]", strings.Join(names, ", "))
+}
+
+func (node Destructure) String() string {
+	prefix := ""
+	if node.IsPublic {
+		prefix = "pub "
+	}
+
 	if node.IsStatic {
-		return fmt.Sprintf("%s := %v", node.Name, node.Value)
+		return fmt.Sprintf("%s%s := %v", prefix, node.Pattern(), node.Value)
 	}
-	return fmt.Sprintf("var %s := %v", node.Name, node.Value)
+	return fmt.Sprintf("%svar %s := %v", prefix, node.Pattern(), node.Value)
 }
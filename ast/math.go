@@ -24,6 +24,8 @@ func (op Operator) String() string {
 
 	case EqOp:
 		return "=="
+	case NeqOp:
+		return "!="
 	case LtOp:
 		return "<"
 	case GtOp:
@@ -37,6 +39,16 @@ func (op Operator) String() string {
 	case AndOp:
 		return "&&"
 
+	case BitAndOp:
+		return "&"
+	case BitOrOp:
+		return "|"
+	case BitXorOp:
+		return "^"
+	case ShlOp:
+		return "<<"
+	case ShrOp:
+		return ">>"
 	}
 
 	return "unknown"
@@ -50,6 +62,7 @@ const (
 	ModOp
 
 	EqOp
+	NeqOp
 	LtOp
 	GtOp
 	LtEqOp
@@ -57,6 +70,12 @@ const (
 
 	OrOp
 	AndOp
+
+	BitAndOp
+	BitOrOp
+	BitXorOp
+	ShlOp
+	ShrOp
 )
 
 type BinOp struct {
@@ -82,6 +101,8 @@ func (node BinOp) String() string {
 
 	case EqOp:
 		return fmt.Sprintf("%v == %v", node.Lhs, node.Rhs)
+	case NeqOp:
+		return fmt.Sprintf("%v != %v", node.Lhs, node.Rhs)
 	case LtOp:
 		return fmt.Sprintf("%v < %v", node.Lhs, node.Rhs)
 	case GtOp:
@@ -95,6 +116,9 @@ func (node BinOp) String() string {
 		return fmt.Sprintf("%v || %v", node.Lhs, node.Rhs)
 	case AndOp:
 		return fmt.Sprintf("%v && %v", node.Lhs, node.Rhs)
+
+	case BitAndOp, BitOrOp, BitXorOp, ShlOp, ShrOp:
+		return fmt.Sprintf("%v %v %v", node.Lhs, node.Operator, node.Rhs)
 	}
 
 	return "unknown"
@@ -133,3 +157,26 @@ type Neg struct {
 	token.Pos      // [required]
 	Value     Node // [required]
 }
+
+// Not negates the truthiness of a value e.g. !done
+type Not struct {
+	token.Pos      // [required]
+	Value     Node // [required]
+}
+
+// BitNot flips every bit of an integer e.g. ~mask
+type BitNot struct {
+	token.Pos      // [required]
+	Value     Node // [required]
+}
+
+// TypeTest checks the type of a value e.g. x is number
+type TypeTest struct {
+	token.Pos        // [required]
+	Value     Node   // [required]
+	Type      string // [required]
+}
+
+func (node TypeTest) String() string {
+	return fmt.Sprintf("%v is %v", node.Value, node.Type)
+}
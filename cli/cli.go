@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -31,31 +32,55 @@ func main() {
 	t := flag.Bool("t", false, "Print execution time")
 	logCaptures := flag.Bool("log-captures", false, "Log when and what is captured")
 	logCache := flag.Bool("log-cache", false, "Log cache hits/misses")
+	maxMemory := flag.Int("max-memory", 0, "Limit the approximate bytes scripts may allocate (0 means no limit)")
+	maxSteps := flag.Int("max-steps", 0, "Limit the number of loop iterations & function calls (0 means no limit)")
 	flag.Parse()
 
 	fileName := os.Args[len(os.Args)-1]
-	if !strings.HasSuffix(fileName, ".ev") {
-		fmt.Println("Provide a file with a .ev extension as the last argument!")
-		return
-	}
-
-	input, err := os.ReadFile(fileName)
-	if err != nil {
-		panic(err)
-	}
-
-	evm := vm.New(vm.Options{
+	opts := vm.Options{
 		LogCache:        *logCache,
 		LogCaptures:     *logCaptures,
 		DisableInlining: !(*inline),
 		Metrics:         *m,
+		MaxSteps:        *maxSteps,
+		MaxMemory:       *maxMemory,
+		TopLevelLogic:   true,
 		//UniversalStatics: evie.ImplicitBuilitins(),
-		ImportsResolver: resolver,
-	})
-	_, err = evm.EvalScript(input)
-	if err != nil {
-		fmt.Println(err)
-		return
+	}
+
+	var evm *vm.Instance
+	if info, err := os.Stat(fileName); err == nil && info.IsDir() {
+		// a module directory, its main package is the entry point
+		mod, err := vm.LoadModule(fileName)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		opts.ImportsResolver = vm.Resolvers(evie.StandardLibraryResolver, mod.Resolver())
+		evm = vm.New(opts)
+		if _, err := evm.Import("main"); err != nil {
+			fmt.Println(err)
+			return
+		}
+	} else {
+		if !strings.HasSuffix(fileName, ".ev") {
+			fmt.Println("Provide a file with a .ev extension or a module directory as the last argument!")
+			return
+		}
+
+		input, err := os.ReadFile(fileName)
+		if err != nil {
+			panic(err)
+		}
+
+		// user packages are looked up next to the script
+		opts.ImportsResolver = vm.Resolvers(evie.StandardLibraryResolver, vm.FileResolver(filepath.Dir(fileName)))
+		evm = vm.New(opts)
+		if _, err := evm.EvalScript(input); err != nil {
+			fmt.Println(err)
+			return
+		}
 	}
 
 	pkgMain := evm.GetPackage("main")
@@ -102,10 +127,3 @@ func main() {
 		fmt.Println("Metrics")
 	} */
 }
-
-func resolver(name string) vm.Package {
-	if constructor, exists := evie.StandardLibraryConstructors[name]; exists {
-		return constructor()
-	}
-	panic(fmt.Errorf("constructor not found for '%v'", name))
-}
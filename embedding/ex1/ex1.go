@@ -17,12 +17,12 @@ func main() {
 
 	// package-statics for packages that import them via the header
 	// e.g. package foo imports("bar")
-	resolver := func(name string) vm.Package {
+	resolver := func(name string) (vm.Package, error) {
 		switch name {
 		case "io":
-			return io.Construct()
+			return io.Construct(), nil
 		}
-		panic(fmt.Errorf("constructor not found for '%v'", name))
+		return nil, fmt.Errorf("%w: constructor not found for '%v'", vm.ErrPackageNotFound, name)
 	}
 
 	// create a vm with our options
@@ -28,10 +28,10 @@ var Defaults = vm.Options{
 	ImportsResolver: StandardLibraryResolver,
 }
 
-// StandardLibrary returns all of the standard library package contructors
-func StandardLibraryResolver(name string) vm.Package {
+// StandardLibraryResolver instantiates the standard library packages
+func StandardLibraryResolver(name string) (vm.Package, error) {
 	if constructor, exists := StandardLibraryConstructors[name]; exists {
-		return constructor()
+		return constructor(), nil
 	}
-	panic(fmt.Errorf("constructor not found for '%v'", name))
+	return nil, fmt.Errorf("%w: constructor not found for '%v'", vm.ErrPackageNotFound, name)
 }
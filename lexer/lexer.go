@@ -42,6 +42,18 @@ func (lex *Lexer) PeekToken() (next token.Token) {
 	return next
 }
 
+// PeekTokenAt returns the token n positions ahead without advancing the lexer; PeekTokenAt(0) == PeekToken()
+func (lex *Lexer) PeekTokenAt(n int) token.Token {
+	for lex.bi+n >= len(lex.backlog) {
+		// same reasoning as in PeekToken
+		i := len(lex.backlog)
+		lex.backlog = append(lex.backlog, token.Token{})
+		next := lex.compose()
+		lex.backlog[i] = next
+	}
+	return lex.backlog[lex.bi+n]
+}
+
 func (lex *Lexer) flag(lit string, line token.Pos) token.Token {
 	return token.Token{Type: token.Type(0), Literal: lit, Line: line}
 }
@@ -73,6 +85,10 @@ START:
 		return lex.simple(lex.option('=', "-=", "-"))
 	case '*':
 		return lex.simple(lex.option('=', "*=", "*"))
+	case '%':
+		return lex.simple(lex.option('=', "%=", "%"))
+	case '!':
+		return lex.simple(lex.option('=', "!=", "!"))
 	case '/':
 		if next, ns := lex.peek(); next == '/' {
 			lex.cursor += ns
@@ -103,18 +119,31 @@ START:
 
 		return lex.simple(lex.option('=', "/=", "/"))
 	case '>':
+		if lex.option('>', ">>", ">") == ">>" {
+			return lex.simple(">>")
+		}
 		return lex.simple(lex.option('=', ">=", ">"))
 	case '<':
+		if lex.option('<', "<<", "<") == "<<" {
+			return lex.simple("<<")
+		}
 		return lex.simple(lex.option('=', "<=", "<"))
 
 	case '|':
 		return lex.simple(lex.option('|', "||", "|"))
 	case '&':
 		return lex.simple(lex.option('&', "&&", "&"))
+	case '^':
+		return lex.simple("^")
+	case '~':
+		return lex.simple("~")
 
 	case ',':
 		return lex.simple(",")
 	case '.':
+		if lex.option('.', "..", ".") == ".." {
+			return lex.simple(lex.option('.', "...", ".."))
+		}
 		return lex.simple(".")
 	case ':':
 		return lex.simple(lex.option('=', ":=", ":"))
@@ -188,11 +217,36 @@ START:
 			// get the starting position of the first digit
 			startPos := lex.cursor - cs
 
+			// 0x, 0b & 0o prefix hex, binary & octal integers
+			base := 10
+			if current == '0' {
+				next, ns := lex.peek()
+				switch next {
+				case 'x', 'X':
+					base = 16
+				case 'b', 'B':
+					base = 2
+				case 'o', 'O':
+					base = 8
+				}
+				if base != 10 {
+					lex.cursor += ns
+				}
+			}
+
 			for next, ns := lex.peek(); next != iEOS; next, ns = lex.peek() {
-				if unicode.IsDigit(next) {
+				if isDigitOf(next, base) {
 					lex.cursor += ns
 					continue
-				} else if next == '.' {
+				} else if next == '_' {
+					// separators like in 1_000_000 have to be between two digits, or follow a prefix like in 0x_ff
+					before, _ := lex.get(lex.cursor - 1)
+					prefixed := base != 10 && lex.cursor-startPos == 2
+					if after, as := lex.get(lex.cursor + ns); (prefixed || isDigitOf(before, base)) && isDigitOf(after, base) {
+						lex.cursor += ns + as
+						continue
+					}
+				} else if next == '.' && base == 10 {
 					// don't swallow the dot immediately; check what is after it
 					if afterDot, ads := lex.get(lex.cursor + ns); unicode.IsDigit(afterDot) {
 						lex.cursor += ns + ads
@@ -303,3 +357,16 @@ func (lex *Lexer) lexTemplateString() {
 func isValidNamePart(r rune) bool {
 	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
 }
+
+// isDigitOf reports whether r is a digit in the given base, which is one of 2, 8, 10 or 16
+func isDigitOf(r rune, base int) bool {
+	switch base {
+	case 2:
+		return r == '0' || r == '1'
+	case 8:
+		return '0' <= r && r <= '7'
+	case 16:
+		return ('0' <= r && r <= '9') || ('a' <= r && r <= 'f') || ('A' <= r && r <= 'F')
+	}
+	return '0' <= r && r <= '9'
+}
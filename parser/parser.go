@@ -16,7 +16,8 @@ var errEOS = errors.New("EOS")
 
 type parser struct {
 	*lexer.Lexer
-	last token.Token
+	last   token.Token
+	yields []bool // whether each of the functions being parsed right now yields
 }
 
 var keywords = []string{
@@ -24,7 +25,7 @@ var keywords = []string{
 	"nil", "true", "false",
 	"var", "fn",
 	"echo",
-	"return",
+	"return", "yield", "defer",
 	"if",
 	"else",
 	"await", "go",
@@ -33,21 +34,25 @@ var keywords = []string{
 
 var operators = map[string]ast.Operator{
 	"+": ast.AddOp, "-": ast.SubOp, "*": ast.MulOp, "/": ast.DivOp, "%": ast.ModOp,
-	"+=": ast.AddOp, "-=": ast.SubOp, "*=": ast.MulOp, "/=": ast.DivOp,
-	"==": ast.EqOp, "<": ast.LtOp, ">": ast.GtOp, "<=": ast.LtEqOp, ">=": ast.GtEqOp,
+	"+=": ast.AddOp, "-=": ast.SubOp, "*=": ast.MulOp, "/=": ast.DivOp, "%=": ast.ModOp,
+	"==": ast.EqOp, "!=": ast.NeqOp, "<": ast.LtOp, ">": ast.GtOp, "<=": ast.LtEqOp, ">=": ast.GtEqOp,
 	"||": ast.OrOp, "&&": ast.AndOp,
+	"&": ast.BitAndOp, "|": ast.BitOrOp, "^": ast.BitXorOp, "<<": ast.ShlOp, ">>": ast.ShrOp,
 }
 
 var precedence = map[string]int{
 	"||": 0,
 	"&&": 1,
-	"<":  2, ">": 2, "==": 2, "<=": 2, ">=": 2,
-	"+": 3, "-": 3,
-	"*": 4, "/": 4, "%": 4,
+	"<":  2, ">": 2, "==": 2, "!=": 2, "<=": 2, ">=": 2, "is": 2,
+	"+": 3, "-": 3, "|": 3, "^": 3,
+	"*": 4, "/": 4, "%": 4, "<<": 4, ">>": 4, "&": 4,
 	".": 5,
 	"(": 6,
 }
 
+// unary is the precedence of the operands of prefix operators like -, ! & ~, they bind tighter than any infix operator
+const unary = 5
+
 func Parse(input []byte) (node ast.Node, err error) {
 	ps := parser{Lexer: lexer.New(input)}
 	var pack ast.Package
@@ -97,6 +102,12 @@ func (ps *parser) consume(lit string) bool {
 	return false
 }
 
+// NextToken advances the lexer and remembers the token as the last one seen
+func (ps *parser) NextToken() token.Token {
+	ps.last = ps.Lexer.NextToken()
+	return ps.last
+}
+
 func (ps *parser) consumeName(lit string) bool {
 	if next := ps.PeekToken(); next.IsWord(lit) && !slices.Contains(keywords, lit) {
 		ps.last = ps.NextToken()
@@ -142,7 +153,7 @@ func (ps *parser) parseStringList() []string {
 
 func (ps *parser) panic(main token.Token, expected string) {
 	context := map[string]string{
-		"fn": "function", "if": "if statement", "else": "else statement", ".": "operator '.'",
+		"fn": "function", "if": "if statement", "else": "else statement", ".": "operator '.'", "for": "for loop", "switch": "switch statement", "try": "try statement", "type": "type declaration", "enum": "enum declaration",
 	}
 	what := context[main.Literal]
 	if what == "" {
@@ -151,15 +162,46 @@ func (ps *parser) panic(main token.Token, expected string) {
 	panic(fmt.Errorf("%v on line %v expected %v, got '%v'", what, main.Line, expected, ps.PeekToken().Literal))
 }
 
-func (ps *parser) parseFloat(literal string) float64 {
-	num, err := strconv.ParseFloat(literal, 64)
-	if err != nil {
+// parseNumber parses a number literal, negated if it follows a '-'; those without a fraction are integers
+func (ps *parser) parseNumber(main token.Token, negative bool) ast.Node {
+	literal := strings.ReplaceAll(main.Literal, "_", "")
+	if strings.Contains(literal, ".") {
+		num, err := strconv.ParseFloat(literal, 64)
+		if err != nil {
+			panic(fmt.Errorf("error parsing number: %v", err))
+		}
+		if negative {
+			num = -num
+		}
+		return ast.Input[float64]{Pos: main.Line, Value: num}
+	}
+
+	var num int64
+	var err error
+	if len(literal) > 1 && literal[0] == '0' && strings.ContainsRune("xXbBoO", rune(literal[1])) {
+		// hex, binary & octal literals can set all 64 bits e.g. 0xcbf29ce484222325
+		var bits uint64
+		bits, err = strconv.ParseUint(literal, 0, 64)
+		num = int64(bits)
+		if negative {
+			num = -num
+		}
+	} else {
+		if negative {
+			literal = "-" + literal
+		}
+		num, err = strconv.ParseInt(literal, 10, 64)
+	}
+
+	if errors.Is(err, strconv.ErrRange) {
+		panic(fmt.Errorf("integer %v on line %v does not fit in 64 bits", main.Literal, main.Line))
+	} else if err != nil {
 		panic(fmt.Errorf("error parsing number: %v", err))
 	}
-	return num
+	return ast.Input[int64]{Pos: main.Line, Value: num}
 }
 
-func (ps *parser) handleWords(main token.Token, asExpr bool) ast.Node {
+func (ps *parser) handleWords(main token.Token, asExpr bool, precedenceLevel int) ast.Node {
 	switch main.Literal {
 	case "echo":
 		return ast.Echo{Pos: main.Line, Value: ps.parse(0, true)}
@@ -169,16 +211,63 @@ func (ps *parser) handleWords(main token.Token, asExpr bool) ast.Node {
 		return ast.Go{Pos: main.Line, Fn: ps.parse(0, true)}
 	case "await":
 		return ps.parseAwait(main)
-	case "nil":
-		return ast.Input[struct{}]{Pos: main.Line}
-	case "true":
-		return ast.Input[bool]{Pos: main.Line, Value: true}
-	case "false":
-		return ast.Input[bool]{Pos: main.Line, Value: false}
 	case "if":
 		return ps.parseConditional(main)
 	case "while":
 		return ps.parseWhile(main)
+	case "for":
+		return ps.parseFor(main)
+	case "switch":
+		return ps.parseSwitch(main)
+	case "try":
+		return ps.parseTry(main)
+	case "nursery":
+		if !ps.consume("{") {
+			ps.panic(main, "'{'")
+		}
+		return ast.Nursery{Pos: main.Line, Action: ps.parseBlock()}
+	case "type", "enum":
+		// type & enum are only keywords in front of a declaration
+		if ps.PeekToken().Type != token.Word || !ps.PeekTokenAt(1).IsSimple("{") {
+			return ps.parseIdent(main, precedenceLevel)
+		}
+
+		name := ps.NextToken().Literal
+		ps.NextToken() // consume '{'
+		if main.Literal == "enum" {
+			return ast.Enum{Pos: main.Line, Name: name, Members: ps.parseNameList(main, "member", name)}
+		}
+		return ast.Type{Pos: main.Line, Name: name, Fields: ps.parseNameList(main, "field", name)}
+	case "throw":
+		return ast.Throw{Pos: main.Line, Value: ps.parse(0, true)}
+	case "catch":
+		if !ps.consume("=>") {
+			ps.panic(main, "'=>'")
+		}
+		return ast.Catch{Pos: main.Line, Value: ps.parse(0, true)}
+	case "defer":
+		if len(ps.yields) == 0 {
+			panic(fmt.Errorf("defer on line %v is outside of a function", main.Line))
+		}
+
+		call, isCall := ps.parse(0, true).(ast.Call)
+		if !isCall {
+			panic(fmt.Errorf("defer on line %v expected a function call", main.Line))
+		}
+		return ast.Defer{Pos: main.Line, Call: call}
+	case "yield":
+		if len(ps.yields) == 0 {
+			panic(fmt.Errorf("yield on line %v is outside of a function", main.Line))
+		}
+		ps.yields[len(ps.yields)-1] = true
+
+		node := ast.Yield{Pos: main.Line}
+		if !ps.PeekToken().IsSimple("}") {
+			node.Value = ps.parse(0, true)
+		} else {
+			node.Value = ast.Input[struct{}]{Pos: main.Line}
+		}
+		return node
 	case "break":
 		return ast.Break{Pos: main.Line}
 	case "continue":
@@ -186,7 +275,8 @@ func (ps *parser) handleWords(main token.Token, asExpr bool) ast.Node {
 	case "return":
 		ret := ast.Return{Pos: main.Line}
 		if !ps.PeekToken().IsSimple("}") {
-			ret.Value = ps.parse(0, true)
+			// return a, b gives back both as an array
+			ret.Value = ps.parseValues(main)
 		} else {
 			ret.Value = ast.Input[struct{}]{Pos: main.Line}
 		}
@@ -205,17 +295,43 @@ func (ps *parser) handleWords(main token.Token, asExpr bool) ast.Node {
 		return ast.Synced{Pos: main.Line, Action: ps.parseBlock()}
 
 	case "var":
+		if pattern, ok := ps.parsePattern(); ok {
+			pattern.Pos, pattern.IsStatic = main.Line, false
+			return pattern
+		}
+
 		name := ps.NextToken()
 		if !ps.consume(":=") {
 			panic(fmt.Errorf("expected ':=' after 'var %v' on line %v, got '%v' instead", name.Literal, main.Line, ps.PeekToken().Literal))
 		}
 		return ast.Decl{Pos: main.Line, Name: name.Literal, IsStatic: false, Value: ps.parse(0, true)}
 	case "pub":
-		// skip for now
-		return ps.parse(0, true)
+		switch node := ps.parse(0, true).(type) {
+		case ast.Fn:
+			if node.Receiver != "" {
+				panic(fmt.Errorf("'pub' on line %v does not apply to methods, they are as visible as their type", main.Line))
+			}
+			if node.Name != "" {
+				node.IsPublic = true
+				return node
+			}
+		case ast.Decl:
+			node.IsPublic = true
+			return node
+		case ast.Destructure:
+			node.IsPublic = true
+			return node
+		case ast.Type:
+			node.IsPublic = true
+			return node
+		case ast.Enum:
+			node.IsPublic = true
+			return node
+		}
+		panic(fmt.Errorf("expected a declaration after 'pub' on line %v", main.Line))
 
 	default:
-		return ps.parseIdent(main)
+		return ps.parseIdent(main, precedenceLevel)
 	}
 }
 
@@ -243,6 +359,50 @@ func (ps *parser) parseStringTemplate(main token.Token) (st ast.StringTemplate)
 	return st
 }
 
+// helper to parse an array literal, the opening '[' is already consumed
+func (ps *parser) parseArray(main token.Token) ast.Node {
+	node := ast.Array{Pos: main.Line}
+	for !ps.consume("]") {
+		node.Elements = append(node.Elements, ps.parse(0, true))
+
+		if ps.consume("]") {
+			break
+		}
+		if !ps.consume(",") {
+			panic(fmt.Errorf("'[' on line %v expected ',' or ']', got '%v'", main.Line, ps.PeekToken().Literal))
+		}
+	}
+	return node
+}
+
+// helper to parse a map literal, the opening '{' is already consumed
+func (ps *parser) parseMap(main token.Token) ast.Node {
+	node := ast.Map{Pos: main.Line}
+	for !ps.consume("}") {
+		key := ps.NextToken()
+		if key.Type != token.Word && key.Type != token.String {
+			panic(fmt.Errorf("'{' on line %v expected a name or a string as key, got '%v'", main.Line, key.Literal))
+		}
+		if slices.Contains(node.Keys, key.Literal) {
+			panic(fmt.Errorf("duplicate key '%v' in map literal on line %v", key.Literal, key.Line))
+		}
+		if !ps.consume(":") {
+			panic(fmt.Errorf("key '%v' on line %v expected ':', got '%v'", key.Literal, key.Line, ps.PeekToken().Literal))
+		}
+
+		node.Keys = append(node.Keys, key.Literal)
+		node.Values = append(node.Values, ps.parse(0, true))
+
+		if ps.consume("}") {
+			break
+		}
+		if !ps.consume(",") {
+			panic(fmt.Errorf("'{' on line %v expected ',' or '}', got '%v'", main.Line, ps.PeekToken().Literal))
+		}
+	}
+	return node
+}
+
 func (ps *parser) parseAwait(main token.Token) ast.Node {
 	// await.all(x, y, z) or await.any(x, y, z)
 	if !ps.consume(".") {
@@ -258,25 +418,138 @@ func (ps *parser) parseAwait(main token.Token) ast.Node {
 	return ast.Await{Task: ps.parse(0, true)}
 }
 
-func (ps *parser) parseIdent(main token.Token) ast.Node {
+func (ps *parser) parseIdent(main token.Token, precedenceLevel int) ast.Node {
+	// an operand of an operator e.g. b in a * b + c, only takes what binds tighter
+	if precedenceLevel > 0 {
+		return ps.parseInfixExpression(ast.Ident{Pos: main.Line, Name: main.Literal}, precedenceLevel)
+	}
+
 	// handle const declarations explicitly
 	if ps.consume(":=") {
 		return ast.Decl{Pos: main.Line, Name: main.Literal, IsStatic: true, Value: ps.parse(0, true)}
 	}
 
+	// x, y := f()
+	if ps.PeekToken().IsSimple(",") && ps.isPattern(1, "") {
+		node := ast.Destructure{Pos: main.Line, Names: []string{main.Literal}, IsStatic: true}
+		ps.NextToken() // consume ','
+		ps.parseNames(&node, "")
+		node.Value = ps.parseValues(main)
+		return node
+	}
+
 	// try infix stuff
 	left := ps.parseInfixExpression(ast.Ident{Pos: main.Line, Name: main.Literal}, 0)
 
 	if ps.consume("=") {
 		return ast.Assign{Pos: main.Line, Lhs: left, Value: ps.parse(0, true)}
 	}
-	if ps.consume("+=") || ps.consume("-=") {
-		return ast.MutableBinOp{Pos: main.Line, Operator: operators[ps.last.Literal], Lhs: left, Rhs: ps.parse(0, true)}
+	if ps.consume("+=") || ps.consume("-=") || ps.consume("*=") || ps.consume("/=") || ps.consume("%=") {
+		op := operators[ps.last.Literal]
+		return ast.MutableBinOp{Pos: main.Line, Operator: op, Lhs: left, Rhs: ps.parse(0, true)}
 	}
 
 	return left
 }
 
+// isPattern reports whether the tokens from the n-th one on are names separated by commas, followed by end & ':='
+func (ps *parser) isPattern(n int, end string) bool {
+	for {
+		if ps.PeekTokenAt(n).IsSimple("...") {
+			n++
+			if ps.PeekTokenAt(n).Type != token.Word {
+				return false
+			}
+			n++
+			break
+		}
+
+		if ps.PeekTokenAt(n).Type != token.Word {
+			return false
+		}
+		n++
+
+		if !ps.PeekTokenAt(n).IsSimple(",") {
+			break
+		}
+		n++
+	}
+
+	if end != "" {
+		if !ps.PeekTokenAt(n).IsSimple(end) {
+			return false
+		}
+		n++
+	}
+	return ps.PeekTokenAt(n).IsSimple(":=")
+}
+
+// parsePattern parses the destructuring forms that can follow 'var', ok is false if there is none
+func (ps *parser) parsePattern() (node ast.Destructure, ok bool) {
+	main := ps.PeekToken()
+	switch {
+	case main.IsSimple("[") && ps.isPattern(1, "]"):
+		ps.NextToken() // consume '['
+		ps.parseNames(&node, "]")
+	case main.IsSimple("{") && ps.isPattern(1, "}"):
+		ps.NextToken() // consume '{'
+		node.FromMap = true
+		ps.parseNames(&node, "}")
+	case main.Type == token.Word && ps.PeekTokenAt(1).IsSimple(",") && ps.isPattern(2, ""):
+		node.Names = append(node.Names, ps.NextToken().Literal)
+		ps.NextToken() // consume ','
+		ps.parseNames(&node, "")
+	default:
+		return node, false
+	}
+
+	node.Pos = main.Line
+	node.IsStatic = true
+	node.Value = ps.parseValues(main)
+	return node, true
+}
+
+// parseNames parses the rest of a pattern checked by isPattern, up to & including the ':='
+func (ps *parser) parseNames(node *ast.Destructure, end string) {
+	for {
+		if ps.consume("...") {
+			node.Rest = ps.NextToken().Literal
+		} else {
+			name := ps.NextToken()
+			if name.Literal != "_" && (slices.Contains(node.Names, name.Literal) || name.Literal == node.Rest) {
+				panic(fmt.Errorf("'%v' is bound twice on line %v", name.Literal, name.Line))
+			}
+			node.Names = append(node.Names, name.Literal)
+		}
+
+		if !ps.consume(",") {
+			break
+		}
+	}
+
+	if slices.Contains(node.Names, node.Rest) {
+		panic(fmt.Errorf("'%v' is bound twice on line %v", node.Rest, ps.last.Line))
+	}
+	if end != "" {
+		ps.consume(end)
+	}
+	ps.consume(":=")
+}
+
+// parseValues parses an expression, several separated by commas become an array e.g. return a, b
+func (ps *parser) parseValues(main token.Token) ast.Node {
+	value := ps.parse(0, true)
+	if !ps.PeekToken().IsSimple(",") {
+		return value
+	}
+
+	values := ast.Array{Pos: main.Line, Elements: []ast.Node{value}}
+	for ps.consume(",") {
+		values.Elements = append(values.Elements, ps.parse(0, true))
+	}
+	return values
+}
+
 func (ps *parser) parseConditional(main token.Token) ast.Node {
 	node := ast.Conditional{Pos: main.Line}
 	node.Condition = ps.parse(0, true)
@@ -307,6 +580,157 @@ func (ps *parser) parseWhile(main token.Token) ast.Node {
 	return node
 }
 
+func (ps *parser) parseTry(main token.Token) ast.Node {
+	node := ast.Try{Pos: main.Line}
+	if !ps.consume("{") {
+		ps.panic(main, "'{'")
+	}
+	node.Action = ps.parseBlock()
+
+	if !ps.consume("catch") {
+		ps.panic(main, "'catch'")
+	}
+	catch := ps.last
+
+	// the name is optional e.g. try {...} catch {...}
+	if ps.PeekToken().Type == token.Word {
+		node.Name = ps.NextToken().Literal
+	}
+
+	if !ps.consume("{") {
+		ps.panic(catch, "'{'")
+	}
+	node.Handler = ps.parseBlock()
+	return node
+}
+
+func (ps *parser) parseSwitch(main token.Token) ast.Node {
+	// switch await { ... } or switch name := await { ... }
+	if ps.PeekToken().IsWord("await") && ps.PeekTokenAt(1).IsSimple("{") {
+		ps.NextToken() // consume 'await'
+		ps.NextToken() // consume '{'
+		node := ast.Select{Pos: main.Line}
+		node.Cases, node.Default = ps.parseCases(main)
+		return node
+	}
+	if ps.PeekToken().IsAnyWord() && ps.PeekTokenAt(1).IsSimple(":=") && ps.PeekTokenAt(2).IsWord("await") && ps.PeekTokenAt(3).IsSimple("{") {
+		node := ast.Select{Pos: main.Line, Name: ps.NextToken().Literal}
+		ps.NextToken() // consume ':='
+		ps.NextToken() // consume 'await'
+		ps.NextToken() // consume '{'
+		node.Cases, node.Default = ps.parseCases(main)
+		return node
+	}
+
+	node := ast.Switch{Pos: main.Line}
+	if !ps.consume("{") {
+		node.Tag = ps.parse(0, true)
+		if !ps.consume("{") {
+			ps.panic(main, "'{'")
+		}
+	}
+	node.Cases, node.Default = ps.parseCases(main)
+	return node
+}
+
+// helper to parse the cases of a switch up until and including the closing '}'
+func (ps *parser) parseCases(main token.Token) (cases []ast.Case, def ast.Node) {
+	for !ps.consume("}") {
+		switch {
+		case ps.consume("case"):
+			c := ast.Case{Pos: ps.last.Line}
+			for {
+				c.Values = append(c.Values, ps.parse(0, true))
+				if !ps.consume(",") {
+					break
+				}
+			}
+			if !ps.consume(":") {
+				ps.panic(main, "':' after case")
+			}
+			c.Action = ps.parseCaseBody()
+			cases = append(cases, c)
+
+		case ps.consume("default"):
+			if def != nil {
+				panic(fmt.Errorf("multiple defaults in switch on line %v", main.Line))
+			}
+			if !ps.consume(":") {
+				ps.panic(main, "':' after default")
+			}
+			def = ps.parseCaseBody()
+
+		default:
+			ps.panic(main, "'case', 'default' or '}'")
+		}
+	}
+	return cases, def
+}
+
+// helper to parse the statements of a case up until the next case, default or '}'
+func (ps *parser) parseCaseBody() ast.Node {
+	block := ast.Block{Pos: ps.last.Line}
+	for {
+		next := ps.PeekToken()
+		if next.IsSimple("}") || next.IsWord("case") || next.IsWord("default") {
+			return block
+		}
+		block.Code = append(block.Code, ps.parse(0, true))
+	}
+}
+
+func (ps *parser) parseFor(main token.Token) ast.Node {
+	node := ast.For{Pos: main.Line}
+	if ps.PeekToken().Type != token.Word {
+		ps.panic(main, "a name")
+	}
+	node.Value = ps.NextToken().Literal
+
+	// for key, value := x
+	if ps.consume(",") {
+		if ps.PeekToken().Type != token.Word {
+			ps.panic(main, "a name after ','")
+		}
+		node.Key, node.Value = node.Value, ps.NextToken().Literal
+	}
+
+	if !ps.consume(":=") {
+		ps.panic(main, "':='")
+	}
+
+	node.Iterable = ps.parse(0, true)
+	if ps.consume("..") {
+		node.Iterable = ast.Range{Pos: ps.last.Line, Start: node.Iterable, End: ps.parse(0, true)}
+	}
+
+	if !ps.consume("{") {
+		ps.panic(main, "'{'")
+	}
+	node.Action = ps.parseBlock()
+	return node
+}
+
+// helper to parse the fields of a type or the members of an enum up until and including the closing '}',
+// they are separated by commas or new lines
+func (ps *parser) parseNameList(main token.Token, what string, owner string) (names []string) {
+	for !ps.consume("}") {
+		if ps.PeekToken().Type != token.Word {
+			ps.panic(main, "a "+what+" name")
+		}
+
+		name := ps.NextToken()
+		if slices.Contains(names, name.Literal) {
+			panic(fmt.Errorf("duplicate %v '%v' in %v '%v' on line %v", what, name.Literal, main.Literal, owner, name.Line))
+		}
+		names = append(names, name.Literal)
+
+		if !ps.consume(",") && !ps.PeekToken().IsSimple("}") && ps.PeekToken().Line == name.Line {
+			ps.panic(main, "',' or '}'")
+		}
+	}
+	return names
+}
+
 // helper to parse a block or single statement
 func (ps *parser) parseBlock() ast.Node {
 	var block ast.Block
@@ -319,10 +743,23 @@ func (ps *parser) parseBlock() ast.Node {
 // helper to parse an fn
 func (ps *parser) parseFn(main token.Token, asExpr bool) ast.Node {
 	fn := ast.Fn{Pos: main.Line, UsedAsExpr: asExpr}
+
+	// fn (p Point) dist() declares a method of Point
+	if ps.PeekToken().IsSimple("(") && ps.PeekTokenAt(1).Type == token.Word && ps.PeekTokenAt(2).Type == token.Word && ps.PeekTokenAt(3).IsSimple(")") {
+		ps.NextToken() // consume '('
+		fn.Args = []string{ps.NextToken().Literal}
+		fn.Receiver = ps.NextToken().Literal
+		ps.NextToken() // consume ')'
+
+		if ps.PeekToken().Type != token.Word {
+			ps.panic(main, "a method name")
+		}
+	}
+
 	if ps.PeekToken().Type == token.Word {
 		fn.Name = ps.NextToken().Literal
 	}
-	fn.Args = ps.parseNamesList(main)
+	ps.parseParams(main, &fn)
 
 	// sync mode
 	switch {
@@ -334,6 +771,7 @@ func (ps *parser) parseFn(main token.Token, asExpr bool) ast.Node {
 		fn.SyncMode = ast.UnsyncedMode
 	}
 
+	ps.yields = append(ps.yields, false)
 	if ps.consume("{") {
 		fn.Action = ps.parseBlock()
 	} else if ps.consume("=>") {
@@ -341,25 +779,52 @@ func (ps *parser) parseFn(main token.Token, asExpr bool) ast.Node {
 	} else {
 		ps.panic(main, "'{' or '=>'")
 	}
+	fn.IsGenerator = ps.yields[len(ps.yields)-1]
+	ps.yields = ps.yields[:len(ps.yields)-1]
+
+	// fn() { ... }() calls it right away
+	if fn.Name == "" && ps.PeekToken().IsSimple("(") && ps.PeekToken().Line == ps.last.Line {
+		fn.UsedAsExpr = true
+		return ps.parseInfixExpression(fn, 0)
+	}
 	return fn
 }
 
-// helper to parse names surrounded by parentheses
-func (ps *parser) parseNamesList(main token.Token) []string {
+// helper to parse the parameters of a function e.g. (a, b = 2, ...rest)
+func (ps *parser) parseParams(main token.Token, fn *ast.Fn) {
 	if !ps.consume("(") {
 		ps.panic(main, "'('")
 	}
 
-	var args []string
 	if ps.consume(")") {
-		return args
+		return
 	}
 
 	for {
+		// the rest parameter has to be the last one
+		if ps.consume("...") {
+			if ps.PeekToken().Type != token.Word {
+				ps.panic(main, "a name after '...'")
+			}
+			fn.Rest = ps.NextToken().Literal
+
+			if !ps.consume(")") {
+				ps.panic(main, "')' after the rest parameter")
+			}
+			return
+		}
+
 		if ps.PeekToken().Type != token.Word {
 			ps.panic(main, "names in parentheses")
 		}
-		args = append(args, ps.NextToken().Literal)
+		fn.Args = append(fn.Args, ps.NextToken().Literal)
+
+		// once a parameter has a default value, all that follow need one too
+		if ps.consume("=") {
+			fn.Defaults = append(fn.Defaults, ps.parse(0, true))
+		} else if len(fn.Defaults) != 0 {
+			ps.panic(main, fmt.Sprintf("a default value for '%v'", fn.Args[len(fn.Args)-1]))
+		}
 
 		if ps.consume(")") {
 			break
@@ -368,7 +833,6 @@ func (ps *parser) parseNamesList(main token.Token) []string {
 			ps.panic(main, "',' or ')'")
 		}
 	}
-	return args
 }
 
 func (ps *parser) parseArgsList() []ast.Node {
@@ -379,7 +843,13 @@ func (ps *parser) parseArgsList() []ast.Node {
 	var args []ast.Node
 	if !ps.PeekToken().IsSimple(")") {
 		for {
-			arg := ps.parse(0, true)
+			var arg ast.Node
+			if spread := ps.PeekToken(); spread.IsSimple("...") {
+				ps.NextToken()
+				arg = ast.Spread{Pos: spread.Line, Value: ps.parse(0, true)}
+			} else {
+				arg = ps.parse(0, true)
+			}
 			args = append(args, arg)
 
 			if ps.PeekToken().IsSimple(",") {
@@ -395,7 +865,6 @@ func (ps *parser) parseArgsList() []ast.Node {
 	}
 
 	return args
-
 }
 
 func (ps *parser) parse(precedenceLevel int, asExpr bool) (node ast.Node) {
@@ -421,21 +890,42 @@ func (ps *parser) parse(precedenceLevel int, asExpr bool) (node ast.Node) {
 	case main.Type == token.String:
 		node = ast.Input[string]{Pos: main.Line, Value: ps.NextToken().Literal}
 	case main.Type == token.Number:
-		node = ast.Input[float64]{Pos: main.Line, Value: ps.parseFloat(ps.NextToken().Literal)}
+		node = ps.parseNumber(ps.NextToken(), false)
 
+	case main.IsWord("nil"):
+		node = ast.Input[struct{}]{Pos: ps.NextToken().Line}
+	case main.IsWord("true"), main.IsWord("false"):
+		node = ast.Input[bool]{Pos: main.Line, Value: ps.NextToken().Literal == "true"}
 	case main.Type == token.Word:
-		return ps.handleWords(ps.NextToken(), asExpr)
+		return ps.handleWords(ps.NextToken(), asExpr, precedenceLevel)
 
 	case main.IsSimple("-"):
 		ps.NextToken()
 		if ps.PeekToken().Type == token.Number {
-			node = ast.Input[float64]{Pos: main.Line, Value: -ps.parseFloat(ps.NextToken().Literal)}
+			node = ps.parseNumber(ps.NextToken(), true)
 		} else {
-			node = ast.Neg{Pos: main.Line, Value: ps.parse(0, true)}
+			node = ast.Neg{Pos: main.Line, Value: ps.parse(unary, true)}
 		}
+	case main.IsSimple("!"):
+		ps.NextToken()
+		node = ast.Not{Pos: main.Line, Value: ps.parse(unary, true)}
+	case main.IsSimple("~"):
+		ps.NextToken()
+		node = ast.BitNot{Pos: main.Line, Value: ps.parse(unary, true)}
 
 	case main.IsSimple("`"):
 		node = ps.parseStringTemplate(ps.NextToken())
+	case main.IsSimple("["), main.IsSimple("{"):
+		// [first, ...rest] := arr or {name, age} := user
+		if pattern, ok := ps.parsePattern(); ok {
+			return pattern
+		}
+
+		if ps.NextToken().IsSimple("[") {
+			node = ps.parseArray(ps.last)
+		} else {
+			node = ps.parseMap(ps.last)
+		}
 	default:
 		panic(main)
 	}
@@ -458,30 +948,20 @@ func (ps *parser) parseInfixExpression(left ast.Node, precedenceLevel int) ast.N
 			continue
 		}
 
-		// function call
-		if next.IsSimple("(") {
-			line := next.Line
-			ps.NextToken() // consume '('
-
-			var args []ast.Node
-			// parse arguments if any
-			if !ps.PeekToken().IsSimple(")") {
-				for {
-					arg := ps.parse(0, true)
-					args = append(args, arg)
-
-					if ps.PeekToken().IsSimple(",") {
-						ps.NextToken() // consume ','
-					} else {
-						break
-					}
-				}
+		// index access; must start on the same line so a new statement is never swallowed
+		if next.IsSimple("[") && next.Line == ps.last.Line {
+			ps.NextToken() // consume '['
+			index := ps.parse(0, true)
+			if !ps.consume("]") {
+				panic(fmt.Errorf("'[' expected ']' on line %v, got '%v'", next.Line, ps.PeekToken().Literal))
 			}
+			left = ast.Index{Pos: next.Line, Lhs: left, Index: index}
+			continue
+		}
 
-			if !ps.consume(")") {
-				panic(fmt.Errorf("'(' expected ')' on line %v, got '%v'", line, ps.PeekToken().Literal))
-			}
-			left = ast.Call{Pos: line, Fn: left, Args: args}
+		// function call
+		if next.IsSimple("(") {
+			left = ast.Call{Pos: next.Line, Fn: left, Args: ps.parseArgsList()}
 			continue
 		}
 
@@ -493,6 +973,16 @@ func (ps *parser) parseInfixExpression(left ast.Node, precedenceLevel int) ast.N
 
 		// consume the operator
 		ps.NextToken()
+
+		// type test; the right-hand side is a type name, not an expression
+		if next.IsWord("is") {
+			if ps.PeekToken().Type != token.Word {
+				panic(fmt.Errorf("'is' on line %v expected a type name, got '%v'", next.Line, ps.PeekToken().Literal))
+			}
+			left = ast.TypeTest{Pos: next.Line, Value: left, Type: ps.NextToken().Literal}
+			continue
+		}
+
 		// parse the right-hand side with higher precedence level
 		right := ps.parse(currentPrecedence+1, true)
 		left = ast.BinOp{Pos: next.Line, Lhs: left, Operator: operators[next.Literal], Rhs: right}
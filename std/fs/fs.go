@@ -9,6 +9,7 @@ import (
 func Construct() vm.Package {
 	pkg := vm.NewHostPackage("fs")
 	pkg.SetSymbol("readFile", vm.BoxGoFuncUnsynced(readFile))
+	pkg.Require("readFile", "fs:read", 0)
 	return pkg
 }
 
@@ -16,7 +17,7 @@ func readFile(fileName vm.Value) (vm.Value, *vm.Exception) {
 	if fileName, ok := fileName.AsString(); ok {
 		bytes, err := os.ReadFile(fileName)
 		if err != nil {
-			return vm.Value{}, vm.CustomError(err.Error())
+			return vm.Value{}, vm.CustomError("%v", err)
 		}
 
 		return vm.BoxBuffer(bytes), nil
@@ -40,6 +40,10 @@ var readln = vm.BoxGoFuncUnsynced(func() (vm.Value, *vm.Exception) {
 })
 
 var dec = vm.BoxGoFunc(func(n vm.Value) (vm.Value, *vm.Exception) {
+	if i, ok := n.AsInt64(); ok {
+		return vm.BoxInt(i - 1), nil
+	}
+
 	f64, ok := n.AsFloat64()
 	if !ok {
 		return vm.Value{}, vm.ErrTypes
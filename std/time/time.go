@@ -9,6 +9,7 @@ import (
 func Construct() vm.Package {
 	pkg := vm.NewHostPackage("io")
 	pkg.SetSymbol("wait", vm.BoxGoFuncUnsynced(wait))
+	pkg.Require("wait", "time:sleep")
 	return pkg
 }
 
@@ -1,7 +1,37 @@
 package vm
 
+import "github.com/hxkhan/evie/vm/fields"
+
 var builtins = map[string]*Value{
 	"string": BoxGoFunc(func(a Value) (Value, *Exception) {
 		return BoxString(a.String()), nil
 	}).Allocate(),
+
+	"error": withMembers(BoxGoFunc(func(msg Value) (Value, *Exception) {
+		return BoxError(NewError(messageOf(msg), nil)), nil
+	}), map[string]Value{
+		"wrap": BoxGoFunc(func(msg, cause Value) (Value, *Exception) {
+			if cause, ok := cause.AsError(); ok {
+				return BoxError(NewError(messageOf(msg), cause)), nil
+			}
+			return Value{}, TypeError([]Value{msg, cause}, "string", "error")
+		}),
+	}).Allocate(),
+}
+
+// withMembers attaches fields to a Go function so it can double as a namespace
+func withMembers(fn Value, members map[string]Value) Value {
+	gf, _ := fn.AsGoFunc()
+	gf.members = make(map[fields.ID]*Value, len(members))
+	for name, value := range members {
+		gf.members[fields.Get(name)] = value.Allocate()
+	}
+	return fn
+}
+
+func messageOf(msg Value) string {
+	if str, ok := msg.AsString(); ok {
+		return str
+	}
+	return msg.String()
 }
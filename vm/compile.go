@@ -2,9 +2,15 @@ package vm
 
 import (
 	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"unsafe"
 
 	"github.com/hxkhan/evie/ast"
 	"github.com/hxkhan/evie/ds"
+	"github.com/hxkhan/evie/token"
 	"github.com/hxkhan/evie/vm/fields"
 )
 
@@ -21,6 +27,12 @@ func (vm *Instance) compile(node ast.Node) instruction {
 			return value, nil
 		}
 
+	case ast.Input[int64]:
+		value := BoxInt(node.Value)
+		return func(fbr *fiber) (Value, *Exception) {
+			return value, nil
+		}
+
 	case ast.Input[float64]:
 		value := BoxNumber(node.Value)
 		return func(fbr *fiber) (Value, *Exception) {
@@ -44,7 +56,7 @@ func (vm *Instance) compile(node ast.Node) instruction {
 			args[i] = vm.compile(arg)
 		}
 
-		return func(fbr *fiber) (Value, *Exception) {
+		return vm.allocates(func(fbr *fiber) (Value, *Exception) {
 			params := make([]any, len(args))
 
 			for i, param := range args {
@@ -57,7 +69,7 @@ func (vm *Instance) compile(node ast.Node) instruction {
 			}
 
 			return BoxString(fmt.Sprintf(node.Format, params...)), nil
-		}
+		})
 
 	case ast.Echo:
 		what := vm.compile(node.Value)
@@ -75,6 +87,15 @@ func (vm *Instance) compile(node ast.Node) instruction {
 	case ast.Decl:
 		return vm.emitIdentDec(node)
 
+	case ast.Destructure:
+		return vm.emitDestructure(node)
+
+	case part:
+		if node.index == len(node.pattern.Names) {
+			return vm.allocates(vm.emitPart(node))
+		}
+		return vm.emitPart(node)
+
 	case ast.Ident:
 		return vm.emitIdentGet(node)
 
@@ -90,6 +111,27 @@ func (vm *Instance) compile(node ast.Node) instruction {
 	case ast.While:
 		return vm.emitWhile(node)
 
+	case ast.For:
+		return vm.emitFor(node)
+
+	case ast.Switch:
+		return vm.emitSwitch(node)
+
+	case ast.Select:
+		return vm.emitSelect(node)
+
+	case ast.Nursery:
+		return vm.emitNursery(node)
+
+	case ast.Try:
+		return vm.emitTry(node)
+
+	case ast.Throw:
+		return vm.emitThrow(node)
+
+	case ast.Catch:
+		return vm.emitCatch(node)
+
 	case ast.Break:
 		return func(fbr *fiber) (Value, *Exception) {
 			return Value{}, breakSignal
@@ -147,12 +189,27 @@ func (vm *Instance) compile(node ast.Node) instruction {
 	case ast.Fn:
 		return vm.emitFn(node)
 
+	case ast.Type:
+		return vm.emitType(node)
+
+	case ast.Enum:
+		panic(fmt.Errorf("enum '%v' on line %v has to be declared on the package level", node.Name, node.Line()))
+
 	case ast.Call:
 		return vm.emitCall(node)
 
 	case ast.FieldAccess:
 		return vm.emitFieldAccess(node)
 
+	case ast.Array:
+		return vm.allocates(vm.emitArray(node))
+
+	case ast.Map:
+		return vm.allocates(vm.emitMap(node))
+
+	case ast.Index:
+		return vm.emitIndex(node)
+
 	case ast.Go:
 		return vm.emitGo(node)
 
@@ -165,157 +222,471 @@ func (vm *Instance) compile(node ast.Node) instruction {
 	case ast.AwaitAll:
 		return vm.emitAwaitAll(node)
 
+	case ast.AwaitAny:
+		return vm.emitAwaitAny(node)
+
 	case ast.Neg:
 		return vm.emitNeg(node)
 
+	case ast.Not:
+		return vm.emitNot(node)
+
+	case ast.BitNot:
+		return vm.emitBitNot(node)
+
 	case ast.BinOp:
+		// concatenating strings allocates
+		if node.Operator == ast.AddOp {
+			return vm.allocates(vm.emitBinOp(node))
+		}
 		return vm.emitBinOp(node)
 
 	case ast.MutableBinOp:
 		return vm.emitMutableBinOp(node)
+
+	case ast.TypeTest:
+		return vm.emitTypeTest(node)
+
+	case ast.Yield:
+		return vm.emitYield(node)
+
+	case ast.Defer:
+		return vm.emitDefer(node)
+
+	case ast.Spread:
+		panic(CustomError("'%v' on line %v can only be used as a call argument", node, node.Line()))
 	}
 
 	panic(fmt.Errorf("implement %T", node))
 }
 
-func (vm *Instance) runPackage(node ast.Package) (Value, *Exception) {
-	vm.cp.pkg = vm.rt.packages[node.Name]
+// runPackage compiles & initialises the files of a package together, so they can refer to each other
+func (vm *Instance) runPackage(scope *task, files ...ast.Package) (result Value, exc *Exception) {
+	name := files[0].Name
+	vm.cp.pkg = vm.rt.packages[name]
 	if vm.cp.pkg == nil {
 		vm.cp.pkg = &packageInstance{
-			name:    node.Name,
+			name:    name,
 			globals: map[fields.ID]Global{},
 		}
-		vm.rt.packages[node.Name] = vm.cp.pkg
+		vm.rt.packages[name] = vm.cp.pkg
+
+		// forget a package that fails to load, also by a compile error, so the script can be run again
+		defer func() {
+			r := recover()
+			if r != nil || exc != nil {
+				delete(vm.rt.packages, name)
+			}
+			if r != nil {
+				panic(r)
+			}
+		}()
 	}
 
 	this := vm.cp.pkg
-	// first make sure all static imports are resolved
-	for _, name := range node.Imports {
-		pkg := vm.rt.packages[name]
-		if pkg == nil {
-			pkg = vm.cp.resolver(name).(*packageInstance)
+	vm.cp.loading = append(vm.cp.loading, name)
+	defer func() { vm.cp.loading = vm.cp.loading[:len(vm.cp.loading)-1] }()
 
-			// save as loaded package
-			vm.rt.packages[name] = pkg
+	var code []ast.Node
+	for _, file := range files {
+		if file.Name != name {
+			panic(fmt.Errorf("file of package '%v' declares package '%v'", name, file.Name))
 		}
 
-		v := pkg.Box()
-		this.globals[fields.Get(name)] = Global{Value: &v, IsPublic: false, IsStatic: true}
+		for _, node := range file.Code {
+			destructure, isDestructure := node.(ast.Destructure)
+			if !isDestructure {
+				code = append(code, node)
+				continue
+			}
+
+			if !vm.cp.topLevelLogic && !ast.IsCallFree(destructure.Value) {
+				panic(fmt.Errorf("declaration of %s contains functions calls, enable Options.TopLevelLogic to allow them", destructure.Pattern()))
+			}
+			for _, decl := range unpack(destructure) {
+				code = append(code, decl)
+			}
+		}
+
+		// first make sure all static imports are resolved
+		for _, name := range file.Imports {
+			pkg, exc := vm.importPackage(scope, name)
+			if exc != nil {
+				return Value{}, exc
+			}
+
+			v := pkg.Box()
+			this.globals[fields.Get(name)] = Global{Value: &v, IsPublic: false, IsStatic: true}
+		}
 	}
 
 	/*
 		------ Hoisting Protocol ------
 
-		1. Allocated all symbols without initialization.
-		2. Initialize variables in the order they appear
-		3. Initialize functions (order doesn't matter)
+		1. Allocate all symbols without initialization.
+		2. Initialize bindings that only depend on literals & bindings
+		   initialized before them, in the order they appear
+		3. Compile functions (order doesn't matter)
+		4. Initialize the remaining bindings in the order of their dependencies
+		5. Run the init functions in the order they appear
+
+		Types & enums are created in step 1, the methods of types are compiled along with
+		the functions in step 3, wherever in the package they are declared.
 
-		So this is not possible because the order is maintained:
+		So both of these are possible:
 			x := y + 2
 			y := 10
 
-		But this is:
 			fn hop(a) {
 				return a + x
 			}
 			x := 3
 
-		Also, we only allow literal declarations on the top level
-		This means no calling like:
-			z := hop(8)
+		A binding depends on every binding it refers to, including those
+		referred to by the functions it refers to. So this is a cycle:
+			table := build()
+			fn build() {
+				return table
+			}
+
+		A binding that refers to a type depends on what its methods refer to.
+
+		Calls in declarations like `z := hop(8)` are only allowed with
+		Options.TopLevelLogic.
+
+		All files of a package go through each step before the next one
+		starts, so functions can refer to each other across files.
 	*/
 
-	// 1. allocate (functions)
-	for _, node := range node.Code {
-		if fn, isFn := node.(ast.Fn); isFn {
-			index := fields.Get(fn.Name)
-			if _, exists := this.globals[index]; exists {
-				panic(fmt.Errorf("double declaration of %s", fn.Name))
+	// 1. allocate (functions, types, enums & bindings)
+	var decls []ast.Decl
+	var inits []ast.Fn
+	var methods []ast.Fn
+	// package symbols whose code is compiled in step 3; functions, methods & types that have methods
+	fns := ds.Set[fields.ID]{}
+	// package symbols that each binding, function & type refers to
+	refs := map[fields.ID]ds.Set[fields.ID]{}
+	types := map[fields.ID]*typeInfo{}
+	for _, node := range code {
+		switch node := node.(type) {
+		case ast.Fn:
+			if node.Receiver != "" {
+				methods = append(methods, node)
+				continue
+			}
+
+			if node.Name == "init" {
+				if len(node.Args) != 0 {
+					panic(fmt.Errorf("fn init on line %v cannot take arguments", node.Line()))
+				}
+				inits = append(inits, node)
+				continue
 			}
 
-			mode := fn.SyncMode
-			// effectively inherits from global which is synced
-			if mode == ast.UndefinedMode {
-				mode = ast.SyncedMode
+			index := fields.Get(node.Name)
+			if _, exists := this.globals[index]; exists {
+				panic(fmt.Errorf("double declaration of %s", node.Name))
 			}
 
 			// create a stub for now
-			fn := BoxUserFn(UserFn{
-				funcInfoStatic: &funcInfoStatic{
-					name: fn.Name,
-					args: fn.Args,
-					mode: mode,
-					vm:   vm,
-				},
-			})
-			this.globals[index] = Global{Value: &fn, IsStatic: true}
-		}
-	}
+			stub := BoxUserFn(UserFn{funcInfoStatic: vm.fnInfo(node)})
+			this.globals[index] = Global{Value: &stub, IsPublic: node.IsPublic, IsStatic: true}
+			fns.Add(index)
 
-	// 2. allocate & initialize (bindings)
-	for _, node := range node.Code {
-		if iDec, isIdentDec := node.(ast.Decl); isIdentDec {
-			// check if contains function calls
-			if !ast.IsCallFree(iDec.Value) {
-				panic(fmt.Errorf("declaration of %s contains functions calls", iDec.Name))
+		case ast.Type:
+			index := fields.Get(node.Name)
+			if _, exists := this.globals[index]; exists {
+				panic(fmt.Errorf("double declaration of %s", node.Name))
 			}
 
-			index := fields.Get(iDec.Name)
+			types[index] = newTypeInfo(node)
+			ctor := types[index].constructor()
+			this.globals[index] = Global{Value: &ctor, IsPublic: node.IsPublic, IsStatic: true}
+
+		case ast.Enum:
+			index := fields.Get(node.Name)
 			if _, exists := this.globals[index]; exists {
-				panic(fmt.Errorf("double declaration of %s", iDec.Name))
+				panic(fmt.Errorf("double declaration of %s", node.Name))
 			}
 
-			var value Value
-			switch v := vm.evaluate(iDec.Value).(type) {
-			case Value:
-				value = v
-			case Global:
-				value = *v.Value
-			default:
-				panic("this cant be!!")
+			enum := newEnum(node)
+			this.globals[index] = Global{Value: &enum, IsPublic: node.IsPublic, IsStatic: true}
+
+		case ast.Decl:
+			if !vm.cp.topLevelLogic && !ast.IsCallFree(node.Value) {
+				panic(fmt.Errorf("declaration of %s contains functions calls, enable Options.TopLevelLogic to allow them", node.Name))
+			}
+
+			index := fields.Get(node.Name)
+			if _, exists := this.globals[index]; exists {
+				panic(fmt.Errorf("double declaration of %s", node.Name))
 			}
-			// store the value
-			this.globals[index] = Global{Value: &value, IsStatic: iDec.IsStatic}
+
+			// uninitialized bindings are never inlined
+			value := new(Value)
+			vm.cp.pending[value] = true
+			this.globals[index] = Global{Value: value, IsPublic: node.IsPublic, IsStatic: node.IsStatic}
+			decls = append(decls, node)
+
+		default:
+			panic(fmt.Errorf("'%v' on line %v is not a declaration, top level logic belongs in fn init()", node, node.Line()))
+		}
+	}
+	defer clear(vm.cp.pending)
+
+	// methods go into the method table of their type
+	for _, node := range methods {
+		index := fields.Get(node.Receiver)
+		typ := types[index]
+		if typ == nil {
+			panic(fmt.Errorf("method '%v' on line %v has receiver type '%v', which is not a type of package '%v'", node.Name, node.Line(), node.Receiver, name))
+		}
+
+		info := vm.fnInfo(node)
+		info.name = node.Receiver + "." + node.Name
+		info.receiver = true
+		typ.addMethod(node, BoxUserFn(UserFn{funcInfoStatic: info}))
+
+		// the type depends on whatever its methods refer to
+		if refs[index] == nil {
+			refs[index] = ds.Set[fields.ID]{}
 		}
+		refs[index].Add(fields.Get(info.name))
+		fns.Add(index)
+		fns.Add(fields.Get(info.name))
 	}
 
-	// 3. initialize (functions)
-	for _, node := range node.Code {
-		if fn, isFn := node.(ast.Fn); isFn {
-			global := this.globals[fields.Get(fn.Name)]
-			ufn := (*UserFn)(global.pointer)
+	// initializers of bindings that wait for functions or other bindings
+	waiting := map[fields.ID]instruction{}
 
-			vm.cp.modes.Push(ufn.mode)
-			vm.cp.closures.Push(&closure{freeVars: ds.Set[int]{}, info: ufn.funcInfoStatic})
-			vm.cp.closures.Last(0).scope.OpenBlock()
+	// 2. initialize (bindings that are ready)
+	for _, decl := range decls {
+		index := fields.Get(decl.Name)
+		global := this.globals[index]
 
-			// declare the fn arguments and only then compile the code
-			for _, arg := range fn.Args {
-				vm.cp.closures.Last(0).scope.Declare(arg, false)
+		vm.cp.refs = ds.Set[fields.ID]{}
+		value := vm.evaluate(decl.Value)
+		if value == nil {
+			value = vm.compile(decl.Value)
+		}
+		refs[index], vm.cp.refs = vm.cp.refs, nil
+
+		ready := true
+		for ref := range refs[index] {
+			if fns.Has(ref) || vm.cp.pending[this.globals[ref].Value] {
+				ready = false
 			}
+		}
 
-			ufn.code = vm.compile(fn.Action)
-			closure := vm.cp.closures.Pop()
-			vm.cp.modes.Pop()
-			capacity := closure.scope.Capacity()
-			ufn.locals = make([]bool, capacity)
+		if !ready {
+			code, isCode := value.(instruction)
+			if !isCode {
+				code = vm.compile(decl.Value)
+			}
+			waiting[index] = code
+			continue
+		}
 
-			// mark escapee variables
-			recyclable := 0
-			for index := range capacity {
-				if closure.freeVars.Has(index) {
-					ufn.locals[index] = true
-					vm.log.escapesf("CT: fn %v => Local(%v) escapes\n", fn.Name, index)
-				} else {
-					recyclable++
-				}
+		switch v := value.(type) {
+		case Value:
+			*global.Value = v
+		case Global:
+			*global.Value = *v.Value
+		case instruction:
+			// e.g. array literals; these allocate so run them once
+			result, exc := vm.runOnce(scope, v)
+			if exc != nil {
+				return result, exc
+			}
+			*global.Value = result
+		}
+		delete(vm.cp.pending, global.Value)
+	}
+
+	// 3. initialize (functions & methods)
+	for _, node := range code {
+		if fn, isFn := node.(ast.Fn); isFn && (fn.Name != "init" || fn.Receiver != "") {
+			index := fields.Get(fn.Name)
+			ufn := this.globals[index].Value
+			if fn.Receiver != "" {
+				index = fields.Get(fn.Receiver + "." + fn.Name)
+				ufn = types[fields.Get(fn.Receiver)].methods[fields.Get(fn.Name)]
 			}
-			ufn.recyclable = recyclable
+
+			vm.cp.refs = ds.Set[fields.ID]{}
+			vm.compileFn(fn, (*UserFn)(ufn.pointer))
+			refs[index], vm.cp.refs = vm.cp.refs, nil
+		}
+	}
+
+	// 4. initialize (bindings that had to wait)
+	for _, index := range vm.initOrder(decls, fns, waiting, refs) {
+		result, exc := vm.runOnce(scope, waiting[index])
+		if exc != nil {
+			return result, exc
+		}
+
+		global := this.globals[index]
+		*global.Value = result
+		delete(vm.cp.pending, global.Value)
+	}
+
+	// 5. run init functions
+	for _, fn := range inits {
+		ufn := &UserFn{funcInfoStatic: vm.fnInfo(fn)}
+		vm.compileFn(fn, ufn)
+
+		result, exc := vm.runOnce(scope, func(fbr *fiber) (Value, *Exception) {
+			return vm.callValue(fbr, BoxUserFn(*ufn), nil)
+		})
+		if exc != nil {
+			return result, exc
 		}
 	}
 	return Value{}, nil
 }
 
+// runOnce runs top level code on a fresh fiber
+func (vm *Instance) runOnce(scope *task, code instruction) (Value, *Exception) {
+	fbr := vm.rt.fibers.Get().(*fiber)
+	fbr.unsynchronized = false
+	fbr.active = &UserFn{funcInfoStatic: &funcInfoStatic{name: "init"}}
+	fbr.base = 0
+	fbr.stack = fbr.stack[:0]
+	fbr.scope = scope
+
+	result, exc := code(fbr)
+
+	fbr.scope = vm.rt.root
+	vm.rt.fibers.Put(fbr)
+	return result, exc
+}
+
+// fnInfo creates the static info of a package level function
+func (vm *Instance) fnInfo(fn ast.Fn) *funcInfoStatic {
+	mode := fn.SyncMode
+	// effectively inherits from global which is synced
+	if mode == ast.UndefinedMode {
+		mode = ast.SyncedMode
+	}
+
+	return &funcInfoStatic{
+		name:     fn.Name,
+		args:     fn.Args,
+		defaults: make([]instruction, len(fn.Defaults)),
+		rest:     fn.Rest != "",
+		mode:     mode,
+		vm:       vm,
+	}
+}
+
+// declareParams declares the args & rest parameter of fn in the open closure and compiles its default values
+func (vm *Instance) declareParams(fn ast.Fn, info *funcInfoStatic) {
+	scope := &vm.cp.closures.Last(0).scope
+	for _, arg := range fn.Args {
+		scope.Declare(arg, false)
+	}
+	if fn.Rest != "" {
+		scope.Declare(fn.Rest, false)
+	}
+
+	// default values can refer to the args before them
+	for i, value := range fn.Defaults {
+		info.defaults[i] = vm.compile(value)
+	}
+}
+
+// compileFn compiles the body of a package level function into ufn
+func (vm *Instance) compileFn(fn ast.Fn, ufn *UserFn) {
+	vm.cp.modes.Push(ufn.mode)
+	vm.cp.closures.Push(&closure{freeVars: ds.Set[int]{}, info: ufn.funcInfoStatic})
+	vm.cp.closures.Last(0).scope.OpenBlock()
+
+	// declare the fn arguments and only then compile the code
+	vm.declareParams(fn, ufn.funcInfoStatic)
+	ufn.code = vm.metered(vm.compile(fn.Action))
+	closure := vm.cp.closures.Pop()
+	if closure.defers {
+		ufn.code = vm.deferring(ufn.code)
+	}
+	if fn.IsGenerator {
+		ufn.code = vm.generate(ufn.funcInfoStatic, ufn.code)
+	}
+	vm.cp.modes.Pop()
+	capacity := closure.scope.Capacity()
+	ufn.locals = make([]bool, capacity)
+
+	// mark escapee variables
+	recyclable := 0
+	for index := range capacity {
+		if closure.freeVars.Has(index) {
+			ufn.locals[index] = true
+			vm.log.escapesf("CT: fn %v => Local(%v) escapes\n", fn.Name, index)
+		} else {
+			recyclable++
+		}
+	}
+	ufn.recyclable = recyclable
+}
+
+// initOrder sorts the waiting bindings so each comes after everything it refers to, directly or through functions
+func (vm *Instance) initOrder(decls []ast.Decl, fns ds.Set[fields.ID], waiting map[fields.ID]instruction, refs map[fields.ID]ds.Set[fields.ID]) (order []fields.ID) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	state := map[fields.ID]int{}
+	var path []fields.ID
+
+	var visit func(index fields.ID)
+	visit = func(index fields.ID) {
+		_, isWaiting := waiting[index]
+		if !fns.Has(index) && !isWaiting {
+			// initialized already or not of this package
+			return
+		}
+
+		switch state[index] {
+		case visited:
+			return
+		case visiting:
+			// functions may call each other, it's only a cycle if a binding is part of it
+			cycle := append(path[slices.Index(path, index):], index)
+			names := make([]string, len(cycle))
+			isCycle := false
+			for i, index := range cycle {
+				names[i] = fields.Name(index)
+				if _, isWaiting := waiting[index]; isWaiting {
+					isCycle = true
+				}
+			}
+
+			if isCycle {
+				panic(fmt.Errorf("initialization cycle: %v", strings.Join(names, " -> ")))
+			}
+			return
+		}
+
+		state[index] = visiting
+		path = append(path, index)
+		for _, ref := range slices.Sorted(maps.Keys(refs[index])) {
+			visit(ref)
+		}
+		path = path[:len(path)-1]
+		state[index] = visited
+
+		if isWaiting {
+			order = append(order, index)
+		}
+	}
+
+	for _, decl := range decls {
+		visit(fields.Get(decl.Name))
+	}
+	return order
+}
+
 func (vm *Instance) emitIdentDec(node ast.Decl) instruction {
 	index, success := vm.cp.closures.Last(0).scope.Declare(node.Name, node.IsStatic)
 	if !success {
@@ -354,6 +725,120 @@ func (vm *Instance) emitIdentDec(node ast.Decl) instruction {
 	}
 }
 
+// part is the share of a destructured value that one of its names gets
+type part struct {
+	token.Pos
+	whole   ast.Ident       // the hidden binding holding the value
+	pattern ast.Destructure // what the value gets destructured into
+	index   int             // position in pattern.Names, the rest comes after them
+}
+
+func (node part) String() string {
+	if node.index == len(node.pattern.Names) {
+		return fmt.Sprintf("...%v of %v", node.pattern.Rest, node.pattern.Pattern())
+	}
+	return fmt.Sprintf("%v of %v", node.pattern.Names[node.index], node.pattern.Pattern())
+}
+
+// unpack lowers x, y := f() into a hidden binding for the value & a binding per name that picks its part from it,
+// this way destructured bindings are ordinary ones be it as locals, captured variables or globals
+func unpack(node ast.Destructure) []ast.Decl {
+	whole := ast.Ident{Pos: node.Pos, Name: fmt.Sprintf("%v:%v", node.Pattern(), node.Line())}
+	decls := []ast.Decl{{Pos: node.Pos, Name: whole.Name, Value: node.Value, IsStatic: true}}
+
+	bind := func(name string, index int) {
+		if name != "_" {
+			value := part{Pos: node.Pos, whole: whole, pattern: node, index: index}
+			decls = append(decls, ast.Decl{Pos: node.Pos, Name: name, Value: value, IsStatic: node.IsStatic, IsPublic: node.IsPublic})
+		}
+	}
+
+	for i, name := range node.Names {
+		bind(name, i)
+	}
+	if node.Rest != "" {
+		bind(node.Rest, len(node.Names))
+	}
+	return decls
+}
+
+func (vm *Instance) emitDestructure(node ast.Destructure) instruction {
+	decls := unpack(node)
+	code := make([]instruction, len(decls))
+	for i, decl := range decls {
+		code[i] = vm.emitIdentDec(decl)
+	}
+
+	return func(fbr *fiber) (Value, *Exception) {
+		for _, decl := range code {
+			if _, exc := decl(fbr); exc != nil {
+				return Value{}, exc
+			}
+		}
+		return Value{}, nil
+	}
+}
+
+func (vm *Instance) emitPart(node part) instruction {
+	whole := vm.compile(node.whole)
+	names, index := node.pattern.Names, node.index
+
+	if node.pattern.FromMap {
+		key := ""
+		if index < len(names) {
+			key = names[index]
+		}
+
+		return func(fbr *fiber) (Value, *Exception) {
+			value, exc := whole(fbr)
+			if exc != nil {
+				return value, exc
+			}
+
+			m, isMap := value.AsMap()
+			if !isMap {
+				return Value{}, TypeErrorF("cannot destructure a '%v' into %v", value.TypeOf(), node.pattern.Pattern())
+			}
+
+			// missing keys read as nil
+			if index < len(names) {
+				value, _ := m.Get(key)
+				return value, nil
+			}
+
+			rest := NewMap(max(m.Len()-len(names), 0))
+			for key, value := range m.All() {
+				if !slices.Contains(names, key) {
+					rest.Set(key, value)
+				}
+			}
+			return BoxMap(rest), nil
+		}
+	}
+
+	variadic := node.pattern.Rest != ""
+	return func(fbr *fiber) (Value, *Exception) {
+		value, exc := whole(fbr)
+		if exc != nil {
+			return value, exc
+		}
+
+		array, isArray := value.AsArray()
+		if !isArray {
+			return Value{}, TypeErrorF("cannot destructure a '%v' into %v", value.TypeOf(), node.pattern.Pattern())
+		}
+
+		if len(array) < len(names) || (!variadic && len(array) > len(names)) {
+			return Value{}, CustomError("cannot destructure %v value(s) into %v", len(array), node.pattern.Pattern())
+		}
+
+		if index < len(names) {
+			return array[index], nil
+		}
+		return BoxArray(slices.Clone(array[len(names):])), nil
+	}
+}
+
 func (vm *Instance) emitIdentGet(node ast.Ident) instruction {
 	variable, err := vm.cp.reach(node.Name)
 	if err != nil {
@@ -419,57 +904,62 @@ func (vm *Instance) emitAssign(node ast.Assign) instruction {
 		}
 	}
 
+	// handle index assignments
+	if in, isIndex := node.Lhs.(ast.Index); isIndex {
+		lhs := vm.compile(in.Lhs)
+		index := vm.compile(in.Index)
+		value := vm.compile(node.Value)
+
+		return func(fbr *fiber) (Value, *Exception) {
+			lhs, exc := lhs(fbr)
+			if exc != nil {
+				return lhs, exc
+			}
+
+			index, exc := index(fbr)
+			if exc != nil {
+				return index, exc
+			}
+
+			value, exc := value(fbr)
+			if exc != nil {
+				return value, exc
+			}
+
+			if exc := vm.chargeEntry(lhs, index); exc != nil {
+				return Value{}, exc
+			}
+			return Value{}, lhs.setIndex(index, value)
+		}
+	}
+
 	// handle field access assignments
 	if fa, isFieldAccess := node.Lhs.(ast.FieldAccess); isFieldAccess {
+		// optimise: resolve symbols of statically known packages at compile time
 		if iGet, isIdentGet := fa.Lhs.(ast.Ident); isIdentGet {
 			variable, err := vm.cp.reach(iGet.Name)
 			if err != nil {
 				panic(err)
 			}
 
-			switch lhs := variable.(type) {
-			case Global:
-				if lhs.IsStatic {
-					if pkg, ok := lhs.asPackage(); ok {
-						field, exists := pkg.globals[fields.Get(fa.Rhs)]
-						if !exists {
-							panic(TypeErrorF("Symbol '%s' not found in package '%s'.", fa.Rhs, pkg.name))
-						}
-
-						if field.IsStatic {
-							panic(TypeErrorF("Assignment to constant symbol '%v' of package '%v'.", fa.Rhs, pkg.name))
-						}
-
-						// compile new value & return setter
-						value := vm.compile(node.Value)
-						return func(fbr *fiber) (Value, *Exception) {
-							value, err := value(fbr)
-							if err != nil {
-								return value, err
-							}
-
-							*(field.Value) = value
-							return Value{}, nil
-						}
+			if lhs, isGlobal := variable.(Global); isGlobal && lhs.IsStatic {
+				if pkg, ok := lhs.asPackage(); ok {
+					field, exists := pkg.globals[fields.Get(fa.Rhs)]
+					if !exists {
+						panic(TypeErrorF("Symbol '%s' not found in package '%s'.", fa.Rhs, pkg.name))
 					}
 
-					panic("not a package")
-				}
-
-				// compile new value & return setter
-				value := vm.compile(node.Value)
-				index := fields.Get(fa.Rhs)
-				return func(fbr *fiber) (Value, *Exception) {
-					if pkg, ok := lhs.asPackage(); ok {
-						field, exists := pkg.globals[index]
-						if !exists {
-							panic(TypeErrorF("Symbol '%s' not found in package '%s'.", fa.Rhs, pkg.name))
-						}
+					if !field.IsPublic {
+						panic(TypeErrorF("Assignment to private symbol '%v' of package '%v'.", fa.Rhs, pkg.name))
+					}
 
-						if field.IsStatic {
-							panic(TypeErrorF("Assignment to constant symbol '%v' of package '%v'.", fa.Rhs, pkg.name))
-						}
+					if field.IsStatic {
+						panic(TypeErrorF("Assignment to constant symbol '%v' of package '%v'.", fa.Rhs, pkg.name))
+					}
 
+					// compile new value & return setter
+					value := vm.compile(node.Value)
+					return func(fbr *fiber) (Value, *Exception) {
 						value, err := value(fbr)
 						if err != nil {
 							return value, err
@@ -478,16 +968,40 @@ func (vm *Instance) emitAssign(node ast.Assign) instruction {
 						*(field.Value) = value
 						return Value{}, nil
 					}
-					panic("not a package")
 				}
 			}
 		}
+
+		// generic compilation
+		lhs := vm.compile(fa.Lhs)
+		value := vm.compile(node.Value)
+		index := fields.Get(fa.Rhs)
+		return func(fbr *fiber) (Value, *Exception) {
+			lhs, exc := lhs(fbr)
+			if exc != nil {
+				return lhs, exc
+			}
+
+			value, exc := value(fbr)
+			if exc != nil {
+				return value, exc
+			}
+
+			if exc := vm.chargeEntry(lhs, BoxString(fa.Rhs)); exc != nil {
+				return Value{}, exc
+			}
+			return Value{}, lhs.setField(index, value)
+		}
 	}
 
 	panic("ayo what")
 }
 
 func (vm *Instance) emitFn(node ast.Fn) instruction {
+	if node.Receiver != "" {
+		panic(fmt.Errorf("method '%v' on line %v has to be declared on the package level", node.Name, node.Line()))
+	}
+
 	mode := node.SyncMode
 	// inherit from parent (if not specified)
 	if mode == ast.UndefinedMode {
@@ -497,22 +1011,28 @@ func (vm *Instance) emitFn(node ast.Fn) instruction {
 
 	// create static info object
 	info := &funcInfoStatic{
-		name: node.Name,
-		args: node.Args,
-		mode: mode,
-		vm:   vm,
+		name:     node.Name,
+		args:     node.Args,
+		defaults: make([]instruction, len(node.Defaults)),
+		rest:     node.Rest != "",
+		mode:     mode,
+		vm:       vm,
 	}
 
 	vm.cp.closures.Push(&closure{freeVars: ds.Set[int]{}, info: info})
 	vm.cp.closures.Last(0).scope.OpenBlock()
 
 	// declare the fn arguments and only then compile the code
-	for _, arg := range node.Args {
-		vm.cp.closures.Last(0).scope.Declare(arg, false)
-	}
+	vm.declareParams(node, info)
 
-	info.code = vm.compile(node.Action)
+	info.code = vm.metered(vm.compile(node.Action))
 	closure := vm.cp.closures.Pop()
+	if closure.defers {
+		info.code = vm.deferring(info.code)
+	}
+	if node.IsGenerator {
+		info.code = vm.generate(info, info.code)
+	}
 	vm.cp.modes.Pop()
 	info.captures = closure.captures
 	capacity := closure.scope.Capacity()
@@ -587,26 +1107,52 @@ func (vm *Instance) emitFn(node ast.Fn) instruction {
 }
 
 func (vm *Instance) emitCall(node ast.Call) instruction {
-	// compile arguments
-	arguments := make([]instruction, len(node.Args))
-	for i, arg := range node.Args {
-		arguments[i] = vm.compile(arg)
+	// spread arguments are only known at run time
+	if spread := vm.emitSpreadArgs(node.Args); spread != nil {
+		value := vm.compile(node.Fn)
+		return func(fbr *fiber) (Value, *Exception) {
+			value, exc := value(fbr)
+			if exc != nil {
+				return value, exc
+			}
+
+			arguments, exc := spread(fbr)
+			if exc != nil {
+				return Value{}, exc
+			}
+			return vm.callValue(fbr, value, arguments)
+		}
+	}
+
+	// compile arguments
+	arguments := make([]instruction, len(node.Args))
+	for i, arg := range node.Args {
+		arguments[i] = vm.compile(arg)
 	}
 
 	// optimise: calling static functions/bindings
 	if value, ok := vm.evaluate(node.Fn).(Value); ok {
 		// try evie fn
 		if fn, isUserFn := value.AsUserFn(); isUserFn {
-			if len(fn.args) != len(arguments) {
-				if fn.name != "λ" {
-					panic(CustomError("function '%v' requires %v argument(s), %v provided", fn.name, len(fn.args), len(arguments)))
+			if exc := fn.checkArity(len(arguments)); exc != nil {
+				panic(exc)
+			}
+
+			// default & rest parameters need the general path
+			if fn.flexible() {
+				return func(fbr *fiber) (Value, *Exception) {
+					return vm.callFlexible(fbr, fn, arguments)
 				}
-				panic(CustomError("function requires %v argument(s), %v provided", len(fn.args), len(arguments)))
 			}
 
 			// optimise: call to ourselves (recursion)
 			if vm.cp.closures.Len() > 0 && fn.funcInfoStatic == vm.cp.closures.Last(0).info {
 				return func(fbr *fiber) (result Value, exc *Exception) {
+					// every call is a cancellation checkpoint
+					if exc := fbr.cancelled(); exc != nil {
+						return Value{}, exc
+					}
+
 					// setup stack locals
 					base := len(fbr.stack)
 					for idx, escapes := range fn.locals {
@@ -620,6 +1166,7 @@ func (vm *Instance) emitCall(node ast.Call) instruction {
 						if idx < len(arguments) {
 							arg, exc := arguments[idx](fbr)
 							if exc != nil {
+								fbr.unwind(fn, base)
 								return arg, exc
 							}
 
@@ -673,6 +1220,11 @@ func (vm *Instance) emitCall(node ast.Call) instruction {
 
 			// optimise: call to an arbitrary static global
 			return func(fbr *fiber) (result Value, exc *Exception) {
+				// every call is a cancellation checkpoint
+				if exc := fbr.cancelled(); exc != nil {
+					return Value{}, exc
+				}
+
 				// setup stack locals
 				base := len(fbr.stack)
 				for idx, escapes := range fn.locals {
@@ -686,6 +1238,7 @@ func (vm *Instance) emitCall(node ast.Call) instruction {
 					if idx < len(arguments) {
 						arg, exc := arguments[idx](fbr)
 						if exc != nil {
+							fbr.unwind(fn, base)
 							return arg, exc
 						}
 
@@ -776,6 +1329,19 @@ func (vm *Instance) emitCall(node ast.Call) instruction {
 					panic("fix.")
 				}
 
+				// calling a function stored in a map
+				if _, ok := obj.AsMap(); ok {
+					value, _ := obj.getField(index)
+					return vm.callValue(fbr, value, arguments)
+				}
+
+				// calling a function stored in a field of a record
+				if r, ok := obj.AsRecord(); ok {
+					if i, exists := r.typ.index[index]; exists {
+						return vm.callValue(fbr, r.values[i], arguments)
+					}
+				}
+
 				// 100% method
 				value := obj.dotAccess(index)
 				if value == nil {
@@ -788,106 +1354,226 @@ func (vm *Instance) emitCall(node ast.Call) instruction {
 
 	// generic compilation
 	value := vm.compile(node.Fn)
-	return func(fbr *fiber) (result Value, exc *Exception) {
+	return func(fbr *fiber) (Value, *Exception) {
 		value, exc := value(fbr)
 		if exc != nil {
 			return value, exc
 		}
 
-		// check if it is a user function
-		if fn, isUserFn := value.AsUserFn(); isUserFn {
-			if len(fn.args) != len(arguments) {
-				if fn.name != "λ" {
-					return Value{}, CustomError("function '%v' requires %v argument(s), %v provided", fn.name, len(fn.args), len(arguments))
-				}
-				return Value{}, CustomError("function requires %v argument(s), %v provided", len(fn.args), len(arguments))
-			}
+		return vm.callValue(fbr, value, arguments)
+	}
+}
 
-			// setup stack locals
-			base := len(fbr.stack)
-			for idx, escapes := range fn.locals {
-				if !escapes {
-					fbr.stack = append(fbr.stack, fbr.pop())
-				} else {
-					fbr.stack = append(fbr.stack, &Value{})
-				}
+// emitSpreadArgs compiles arguments that contain a spread into an instruction that evaluates them all, nil if there is no spread
+func (vm *Instance) emitSpreadArgs(nodes []ast.Node) func(fbr *fiber) ([]instruction, *Exception) {
+	if !slices.ContainsFunc(nodes, func(node ast.Node) bool { _, isSpread := node.(ast.Spread); return isSpread }) {
+		return nil
+	}
 
-				// evaluate arguments
-				if idx < len(arguments) {
-					arg, exc := arguments[idx](fbr)
-					if exc != nil {
-						return arg, exc
-					}
+	args := make([]instruction, len(nodes))
+	spreads := make([]bool, len(nodes))
+	for i, node := range nodes {
+		if spread, isSpread := node.(ast.Spread); isSpread {
+			node, spreads[i] = spread.Value, true
+		}
+		args[i] = vm.compile(node)
+	}
 
-					*(fbr.stack[base+idx]) = arg
-				}
+	return func(fbr *fiber) ([]instruction, *Exception) {
+		var values []Value
+		for i, arg := range args {
+			value, exc := arg(fbr)
+			if exc != nil {
+				return nil, exc
+			}
+
+			if !spreads[i] {
+				values = append(values, value)
+				continue
 			}
 
-			// save current state
-			prevBase := fbr.swapBase(base)
-			prevFn := fbr.swapActive(fn)
+			array, isArray := value.AsArray()
+			if !isArray {
+				return nil, TypeErrorF("cannot spread a '%v', only arrays can be spread", value.TypeOf())
+			}
+			values = append(values, array...)
+		}
+		return constants(values), nil
+	}
+}
 
-			// correctly invoke the function
-			synced := fn.Synced()
-			switch {
-			// no transition
-			case fbr.synced() == synced || fn.mode == ast.AgnosticMode:
-				result, exc = fn.code(fbr)
+// callFlexible calls a function with default or rest parameters
+func (vm *Instance) callFlexible(fbr *fiber, fn *UserFn, arguments []instruction) (result Value, exc *Exception) {
+	if exc := fn.checkArity(len(arguments)); exc != nil {
+		return Value{}, exc
+	}
 
-			// to synced
-			case synced:
-				vm.rt.AcquireGIL()
-				fbr.unsynchronized = false
-				result, exc = fn.code(fbr)
-				fbr.unsynchronized = true
-				vm.rt.ReleaseGIL()
+	// every call is a cancellation checkpoint
+	if exc := fbr.cancelled(); exc != nil {
+		return Value{}, exc
+	}
 
-			// to unsynced
-			default:
-				vm.rt.ReleaseGIL()
-				fbr.unsynchronized = true
-				result, exc = fn.code(fbr)
-				fbr.unsynchronized = false
-				vm.rt.AcquireGIL()
+	// arguments are evaluated up front as the extra ones end up in an array
+	args, exc := evalArgs(fbr, arguments)
+	if exc != nil {
+		return Value{}, exc
+	}
+
+	// save current state
+	prevBase := fbr.swapBase(fbr.frame(fn, args))
+	prevFn := fbr.swapActive(fn)
+
+	// correctly invoke the function
+	if exc = fbr.fill(fn, len(args)); exc == nil {
+		synced := fn.Synced()
+		switch {
+		// no transition
+		case fbr.synced() == synced || fn.mode == ast.AgnosticMode:
+			result, exc = fn.code(fbr)
+
+		// to synced
+		case synced:
+			vm.rt.AcquireGIL()
+			fbr.unsynchronized = false
+			result, exc = fn.code(fbr)
+			fbr.unsynchronized = true
+			vm.rt.ReleaseGIL()
+
+		// to unsynced
+		default:
+			vm.rt.ReleaseGIL()
+			fbr.unsynchronized = true
+			result, exc = fn.code(fbr)
+			fbr.unsynchronized = false
+			vm.rt.AcquireGIL()
+		}
+	}
+
+	// restore old state
+	fbr.push(fn.recyclable)
+	fbr.popStack(len(fn.locals))
+	fbr.swapBase(prevBase)
+	fbr.swapActive(prevFn)
+
+	// return result but catch relevant signals
+	switch exc {
+	case nil:
+		return Value{}, nil
+	case returnSignal:
+		return result, nil
+	default:
+		return result, exc
+	}
+}
+
+// callValue calls any callable value with the given arguments
+func (vm *Instance) callValue(fbr *fiber, value Value, arguments []instruction) (result Value, exc *Exception) {
+	// check if it is a user function
+	if fn, isUserFn := value.AsUserFn(); isUserFn {
+		if fn.flexible() {
+			return vm.callFlexible(fbr, fn, arguments)
+		}
+
+		if len(fn.args) != len(arguments) {
+			if fn.name != "λ" {
+				return Value{}, CustomError("function '%v' requires %v argument(s), %v provided", fn.name, len(fn.args), len(arguments))
 			}
+			return Value{}, CustomError("function requires %v argument(s), %v provided", len(fn.args), len(arguments))
+		}
 
-			// restore old state
-			fbr.push(fn.recyclable)
-			fbr.popStack(len(fn.locals))
-			fbr.swapBase(prevBase)
-			fbr.swapActive(prevFn)
+		// every call is a cancellation checkpoint
+		if exc := fbr.cancelled(); exc != nil {
+			return Value{}, exc
+		}
 
-			// return result but catch relevant signals
-			switch exc {
-			case nil:
-				return Value{}, nil
-			case returnSignal:
-				return result, nil
-			default:
-				return result, exc
+		// setup stack locals
+		base := len(fbr.stack)
+		for idx, escapes := range fn.locals {
+			if !escapes {
+				fbr.stack = append(fbr.stack, fbr.pop())
+			} else {
+				fbr.stack = append(fbr.stack, &Value{})
+			}
+
+			// evaluate arguments
+			if idx < len(arguments) {
+				arg, exc := arguments[idx](fbr)
+				if exc != nil {
+					fbr.unwind(fn, base)
+					return arg, exc
+				}
+
+				*(fbr.stack[base+idx]) = arg
 			}
 		}
 
-		// try go func
-		if fn, isGoFunc := value.AsGoFunc(); isGoFunc {
-			return fn.call(fbr, arguments)
+		// save current state
+		prevBase := fbr.swapBase(base)
+		prevFn := fbr.swapActive(fn)
+
+		// correctly invoke the function
+		synced := fn.Synced()
+		switch {
+		// no transition
+		case fbr.synced() == synced || fn.mode == ast.AgnosticMode:
+			result, exc = fn.code(fbr)
+
+		// to synced
+		case synced:
+			vm.rt.AcquireGIL()
+			fbr.unsynchronized = false
+			result, exc = fn.code(fbr)
+			fbr.unsynchronized = true
+			vm.rt.ReleaseGIL()
+
+		// to unsynced
+		default:
+			vm.rt.ReleaseGIL()
+			fbr.unsynchronized = true
+			result, exc = fn.code(fbr)
+			fbr.unsynchronized = false
+			vm.rt.AcquireGIL()
 		}
 
-		// try method
-		if m, isMethod := value.asMethod(); isMethod {
-			return m.call(fbr, arguments)
+		// restore old state
+		fbr.push(fn.recyclable)
+		fbr.popStack(len(fn.locals))
+		fbr.swapBase(prevBase)
+		fbr.swapActive(prevFn)
+
+		// return result but catch relevant signals
+		switch exc {
+		case nil:
+			return Value{}, nil
+		case returnSignal:
+			return result, nil
+		default:
+			return result, exc
 		}
+	}
+
+	// try go func
+	if fn, isGoFunc := value.AsGoFunc(); isGoFunc {
+		return fn.call(fbr, arguments)
+	}
 
-		return Value{}, CustomError("cannot call a non-function '%v'", value)
+	// try method
+	if m, isMethod := value.asMethod(); isMethod {
+		return m.call(fbr, arguments)
 	}
+
+	return Value{}, CustomError("cannot call a non-function '%v'", value)
 }
 
 func (vm *Instance) emitGo(node ast.Go) instruction {
 	if node, isCall := node.Fn.(ast.Call); isCall {
 		// compile arguments
-		arguments := make([]instruction, len(node.Args))
-		for i, arg := range node.Args {
-			arguments[i] = vm.compile(arg)
+		spread := vm.emitSpreadArgs(node.Args)
+		compiled := make([]instruction, len(node.Args))
+		if spread == nil {
+			for i, arg := range node.Args {
+				compiled[i] = vm.compile(arg)
+			}
 		}
 
 		// generic compilation
@@ -898,13 +1584,24 @@ func (vm *Instance) emitGo(node ast.Go) instruction {
 				return value, exc
 			}
 
+			arguments := compiled
+			if spread != nil {
+				if arguments, exc = spread(fbr); exc != nil {
+					return Value{}, exc
+				}
+			}
+
+			// methods of records run with their receiver as the first argument
+			if m, isMethod := value.asMethod(); isMethod {
+				if _, isUserFn := m.fn.AsUserFn(); isUserFn {
+					value, arguments = m.fn, append(constants([]Value{m.this}), arguments...)
+				}
+			}
+
 			// check if it is a user function
 			if fn, isUserFn := value.AsUserFn(); isUserFn {
-				if len(fn.args) != len(arguments) {
-					if fn.name != "λ" {
-						return Value{}, CustomError("function '%v' requires %v argument(s), %v provided", fn.name, len(fn.args), len(arguments))
-					}
-					return Value{}, CustomError("function requires %v argument(s), %v provided", len(fn.args), len(arguments))
+				if exc := fn.checkArity(len(arguments)); exc != nil {
+					return Value{}, exc
 				}
 
 				// evaluate arguments
@@ -927,7 +1624,8 @@ func (vm *Instance) emitGo(node ast.Go) instruction {
 					unsynced = false
 				}
 
-				task := make(chan evaluation, 1)
+				t := newTask(fbr.scope)
+				t.name = fn.name
 				vm.rt.wg.Go(func() {
 					// setup new fiber
 					fbr := vm.rt.fibers.Get().(*fiber)
@@ -935,53 +1633,41 @@ func (vm *Instance) emitGo(node ast.Go) instruction {
 					fbr.base = 0
 					fbr.stack = fbr.stack[:0]
 					fbr.unsynchronized = unsynced
+					fbr.scope = t
 
 					// setup stack locals
-					for idx, escapes := range fn.locals {
-						if !escapes {
-							fbr.stack = append(fbr.stack, fbr.pop())
-						} else {
-							fbr.stack = append(fbr.stack, &Value{})
-						}
-
-						// assign arguments
-						if idx < len(params) {
-							*(fbr.stack[idx]) = params[idx]
-						}
-					}
+					fbr.frame(fn, params)
 
 					// run code
-					if fbr.unsynced() {
-						result, exc = fn.code(fbr)
-					} else {
+					if !fbr.unsynced() {
 						vm.rt.AcquireGIL()
+					}
+					if exc = fbr.fill(fn, len(params)); exc == nil {
 						result, exc = fn.code(fbr)
+					}
+					if !fbr.unsynced() {
 						vm.rt.ReleaseGIL()
 					}
 
 					// cleanup fiber and release
 					fbr.push(fn.recyclable)
 					fbr.popStack(len(fn.locals))
+					fbr.scope = vm.rt.root
 					vm.rt.fibers.Put(fbr)
 
 					// return result but catch relevant signals
-					switch exc {
-					case nil:
-					case returnSignal:
+					if exc == returnSignal {
 						exc = nil
-					default:
-						panic(exc)
 					}
-					task <- evaluation{result: result, err: exc}
-					close(task)
+					vm.settle(t, result, exc)
 				})
 
-				return BoxTask(task), nil
+				return BoxTask(t), nil
 			}
 
 			// try go func
 			if fn, isGoFunc := value.AsGoFunc(); isGoFunc {
-				if fn.nargs != len(arguments) {
+				if fn.nargs != -1 && fn.nargs != len(arguments) {
 					return Value{}, CustomError("function requires %v argument(s), %v provided", fn.nargs, len(arguments))
 				}
 
@@ -995,7 +1681,8 @@ func (vm *Instance) emitGo(node ast.Go) instruction {
 					unsynced = false
 				}
 
-				task := make(chan evaluation, 1)
+				t := newTask(fbr.scope)
+				t.name = "λ"
 				vm.rt.wg.Go(func() {
 					var result Value
 					var exc *Exception
@@ -1009,11 +1696,10 @@ func (vm *Instance) emitGo(node ast.Go) instruction {
 						vm.rt.ReleaseGIL()
 					}
 
-					task <- evaluation{result: result, err: exc}
-					close(task)
+					vm.settle(t, result, exc)
 				})
 
-				return BoxTask(task), nil
+				return BoxTask(t), nil
 			}
 
 			return Value{}, CustomError("cannot call a non-function '%v'", value)
@@ -1022,9 +1708,63 @@ func (vm *Instance) emitGo(node ast.Go) instruction {
 	panic("go expected call, got something else")
 }
 
+// metered makes code count as one step towards Options.MaxSteps; without a limit code is returned as is
+func (vm *Instance) metered(code instruction) instruction {
+	if vm.rt.maxSteps == 0 {
+		return code
+	}
+
+	return func(fbr *fiber) (Value, *Exception) {
+		if vm.rt.steps.Add(1) > vm.rt.maxSteps {
+			return Value{}, ErrLimitExceeded
+		}
+		return code(fbr)
+	}
+}
+
+func (vm *Instance) emitNursery(node ast.Nursery) instruction {
+	action := vm.compile(node.Action)
+
+	return func(fbr *fiber) (Value, *Exception) {
+		nursery := newNursery(fbr.scope)
+
+		// every task spawned inside the block belongs to the nursery
+		outer := fbr.scope
+		fbr.scope = nursery
+		v, exc := action(fbr)
+		fbr.scope = outer
+
+		// an error escaping the block cancels the children
+		if exc != nil && !exc.isSignal() {
+			nursery.fail(exc)
+		}
+
+		// wait for the children; release GIL if synced
+		if fbr.synced() {
+			vm.rt.ReleaseGIL()
+		}
+		nursery.running.Wait()
+		if fbr.synced() {
+			vm.rt.AcquireGIL()
+		}
+		nursery.finish(Value{}, nil)
+
+		if nursery.failure != nil {
+			return Value{}, nursery.failure
+		}
+		return v, exc
+	}
+}
+
 func (vm *Instance) emitReturn(node ast.Return) instruction {
 	if vm.cp.inline {
 		// optimise: returning constants
+		if in, isInput := node.Value.(ast.Input[int64]); isInput {
+			value := BoxInt(in.Value)
+			return func(fbr *fiber) (Value, *Exception) {
+				return value, returnSignal
+			}
+		}
 		if in, isInput := node.Value.(ast.Input[float64]); isInput {
 			value := BoxNumber(in.Value)
 			return func(fbr *fiber) (Value, *Exception) {
@@ -1077,14 +1817,14 @@ func (vm *Instance) emitAwait(node ast.Await) instruction {
 				vm.rt.ReleaseGIL()
 			}
 
-			response, ok := <-task
+			response, exc := fbr.await(task)
 
 			if fbr.synced() {
 				vm.rt.AcquireGIL()
 			}
 
-			if !ok {
-				return Value{}, CustomError("cannot await on a finished task")
+			if exc != nil {
+				return Value{}, exc
 			}
 
 			return response.result, response.err
@@ -1100,7 +1840,7 @@ func (vm *Instance) emitAwaitAll(node ast.AwaitAll) instruction {
 	}
 
 	return func(fbr *fiber) (Value, *Exception) {
-		tasks := make([]<-chan evaluation, len(values))
+		tasks := make([]*task, len(values))
 		for i, value := range values {
 			v, exc := value(fbr)
 			if exc != nil {
@@ -1123,14 +1863,14 @@ func (vm *Instance) emitAwaitAll(node ast.AwaitAll) instruction {
 
 		results := make([]Value, len(values))
 		for i, task := range tasks {
-			response, ok := <-task
+			response, exc := fbr.await(task)
 
-			if !ok {
+			if exc != nil {
 				// acquire GIL if synced
 				if fbr.synced() {
 					vm.rt.AcquireGIL()
 				}
-				return Value{}, CustomError("cannot await on a finished task")
+				return Value{}, exc
 			}
 
 			if response.err != nil {
@@ -1153,6 +1893,44 @@ func (vm *Instance) emitAwaitAll(node ast.AwaitAll) instruction {
 	}
 }
 
+func (vm *Instance) emitAwaitAny(node ast.AwaitAny) instruction {
+	if len(node.Tasks) == 0 {
+		panic(fmt.Errorf("await.any on line %v requires at least one task", node.Line()))
+	}
+
+	values := make([]instruction, len(node.Tasks))
+	for i, task := range node.Tasks {
+		values[i] = vm.compile(task)
+	}
+
+	return func(fbr *fiber) (Value, *Exception) {
+		boxed := make([]Value, len(values))
+		tasks := make([]*task, len(values))
+		for i, value := range values {
+			v, exc := value(fbr)
+			if exc != nil {
+				return v, exc
+			}
+
+			task, ok := v.AsTask()
+			if !ok {
+				return Value{}, RuntimeExceptionF("cannot await on a value of type '%s'", v.TypeOf())
+			}
+			boxed[i], tasks[i] = v, task
+		}
+
+		i, response, exc := vm.awaitAny(fbr, tasks, true)
+		if exc != nil {
+			return Value{}, exc
+		}
+
+		if response.err != nil {
+			return response.result, response.err
+		}
+		return BoxArray([]Value{boxed[i], response.result}), nil
+	}
+}
+
 func (vm *Instance) emitConditional(node ast.Conditional) instruction {
 	condition := vm.compile(node.Condition)
 	action := vm.compile(node.Action)
@@ -1188,10 +1966,15 @@ func (vm *Instance) emitConditional(node ast.Conditional) instruction {
 
 func (vm *Instance) emitWhile(node ast.While) instruction {
 	condition := vm.compile(node.Condition)
-	action := vm.compile(node.Action)
+	action := vm.metered(vm.compile(node.Action))
 
 	return func(fbr *fiber) (Value, *Exception) {
 		for {
+			// every iteration is a cancellation checkpoint
+			if exc := fbr.cancelled(); exc != nil {
+				return Value{}, exc
+			}
+
 			// evaluate condition
 			v, err := condition(fbr)
 			if err != nil {
@@ -1217,64 +2000,613 @@ func (vm *Instance) emitWhile(node ast.While) instruction {
 	}
 }
 
-func (vm *Instance) emitBlock(node ast.Block) instruction {
-	vm.cp.closures.Last(0).scope.OpenBlock()
-	defer vm.cp.closures.Last(0).scope.CloseBlock()
-
-	// optimise: statement extraction from block; saves an extra dispatch
-	if len(node.Code) == 1 && vm.cp.inline {
-		node := node.Code[0]
-		// optimise: {return x}
-		if ret, isReturn := node.(ast.Return); isReturn {
-			// optimise: returning constants
-			if in, isInput := ret.Value.(ast.Input[float64]); isInput {
-				value := BoxNumber(in.Value)
-				return func(fbr *fiber) (Value, *Exception) {
-					return value, returnSignal
-				}
-			}
+func (vm *Instance) emitTry(node ast.Try) instruction {
+	action := vm.compile(node.Action)
 
-			// optimise: returning locals
-			if iGet, isIdentGet := ret.Value.(ast.Ident); isIdentGet {
-				variable, err := vm.cp.reach(iGet.Name)
-				if err != nil {
-					panic(err)
-				}
+	closure := vm.cp.closures.Last(0)
+	closure.scope.OpenBlock()
+	defer closure.scope.CloseBlock()
 
-				if v, isLocal := variable.(local); isLocal {
-					if v.isCaptured {
-						return func(fbr *fiber) (Value, *Exception) {
-							return fbr.getCaptured(v.index), returnSignal
-						}
-					}
-					return func(fbr *fiber) (Value, *Exception) {
-						return fbr.getLocal(v.index), returnSignal
-					}
-				}
-			}
+	index := -1
+	if node.Name != "" {
+		index, _ = closure.scope.Declare(node.Name, true)
+	}
+	handler := vm.compile(node.Handler)
+	fresh := index != -1 && closure.freeVars.Has(index)
 
-			what := vm.compile(ret.Value)
-			return func(fbr *fiber) (Value, *Exception) {
-				v, err := what(fbr)
-				if err != nil {
-					return v, err
-				}
+	return func(fbr *fiber) (Value, *Exception) {
+		v, exc := action(fbr)
+		// signals are not errors & running out of memory or cancellation must stop the script so let them pass through
+		if exc == nil || fbr.uncatchable(exc) {
+			return v, exc
+		}
 
-				return v, returnSignal
+		if index != -1 {
+			if fresh {
+				fbr.stack[fbr.base+index] = &Value{}
 			}
+			fbr.setLocal(index, BoxError(exc))
 		}
-
-		// generic
-		return vm.compile(node)
+		return handler(fbr)
 	}
+}
 
-	block := make([]instruction, len(node.Code))
-	for i, statement := range node.Code {
-		block[i] = vm.compile(statement)
+func (vm *Instance) emitDefer(node ast.Defer) instruction {
+	vm.cp.closures.Last(0).defers = true
+
+	// the callee & arguments are evaluated right away, only the call itself is put off
+	callee := vm.compile(node.Call.Fn)
+	arguments := vm.emitSpreadArgs(node.Call.Args)
+	if arguments == nil {
+		compiled := make([]instruction, len(node.Call.Args))
+		for i, arg := range node.Call.Args {
+			compiled[i] = vm.compile(arg)
+		}
+
+		arguments = func(fbr *fiber) ([]instruction, *Exception) {
+			values, exc := evalArgs(fbr, compiled)
+			return constants(values), exc
+		}
 	}
 
 	return func(fbr *fiber) (Value, *Exception) {
-		for _, statement := range block {
+		fn, exc := callee(fbr)
+		if exc != nil {
+			return fn, exc
+		}
+
+		args, exc := arguments(fbr)
+		if exc != nil {
+			return Value{}, exc
+		}
+
+		fbr.deferred = append(fbr.deferred, deferral{fn: fn, args: args})
+		return Value{}, nil
+	}
+}
+
+// deferring runs the calls deferred by code once it exits, however it exits & the last one deferred first
+func (vm *Instance) deferring(code instruction) instruction {
+	return func(fbr *fiber) (Value, *Exception) {
+		mark := len(fbr.deferred)
+		result, exc := code(fbr)
+
+		// cleanup has to run in cancelled tasks too
+		if fbr.cancelled() != nil {
+			outer := fbr.scope
+			fbr.scope = vm.rt.root
+			defer func() { fbr.scope = outer }()
+		}
+
+		for len(fbr.deferred) > mark {
+			last := len(fbr.deferred) - 1
+			deferred := fbr.deferred[last]
+			fbr.deferred[last] = deferral{}
+			fbr.deferred = fbr.deferred[:last]
+
+			// like in Go, an error raised by a deferred call replaces the outcome of the function
+			if _, dexc := vm.callValue(fbr, deferred.fn, deferred.args); dexc != nil {
+				result, exc = Value{}, dexc
+			}
+		}
+		return result, exc
+	}
+}
+
+func (vm *Instance) emitThrow(node ast.Throw) instruction {
+	value := vm.compile(node.Value)
+
+	return func(fbr *fiber) (Value, *Exception) {
+		v, exc := value(fbr)
+		if exc != nil {
+			return v, exc
+		}
+
+		if exc, ok := v.AsError(); ok {
+			return Value{}, exc
+		}
+		return Value{}, &Exception{name: "Error", message: v.String()}
+	}
+}
+
+func (vm *Instance) emitCatch(node ast.Catch) instruction {
+	value := vm.compile(node.Value)
+
+	return func(fbr *fiber) (Value, *Exception) {
+		v, exc := value(fbr)
+		if exc == nil || fbr.uncatchable(exc) {
+			return v, exc
+		}
+		return BoxError(exc), nil
+	}
+}
+
+// caseKey is a comparable form of literal values so switches can use them as jump table keys
+type caseKey struct {
+	kind   unsafe.Pointer
+	scalar uint64
+	str    string
+}
+
+func keyOf(v Value) (key caseKey, ok bool) {
+	switch v.pointer {
+	case nil:
+		return caseKey{}, true
+	case boolType:
+		return caseKey{kind: boolType, scalar: v.scalar}, true
+	case i64Type:
+		return caseKey{kind: i64Type, scalar: v.scalar}, true
+	case f64Type:
+		// whole floats share the key of the integer they equal e.g. 1.0 hits case 1
+		if i, isWhole := wholeInt(math.Float64frombits(v.scalar)); isWhole {
+			return caseKey{kind: i64Type, scalar: uint64(i)}, true
+		}
+		return caseKey{kind: f64Type, scalar: v.scalar}, true
+	}
+
+	if str, ok := v.AsString(); ok {
+		return caseKey{kind: strTypeID, str: str}, true
+	}
+
+	// every enum member is a key of its own
+	if _, ok := v.asEnum(); ok {
+		return caseKey{kind: v.pointer}, true
+	}
+	return caseKey{}, false
+}
+
+func (vm *Instance) emitSwitch(node ast.Switch) instruction {
+	var tag instruction
+	if node.Tag != nil {
+		tag = vm.compile(node.Tag)
+
+		// a switch over the members of an enum has to handle all of them, unless it has a default
+		if node.Default == nil {
+			vm.checkExhaustive(node)
+		}
+	}
+
+	actions := make([]instruction, len(node.Cases))
+	values := make([][]instruction, len(node.Cases))
+	for i, c := range node.Cases {
+		values[i] = make([]instruction, len(c.Values))
+		for j, v := range c.Values {
+			values[i][j] = vm.compile(v)
+		}
+		// emitBlock gives each case its own block scope
+		actions[i] = vm.compile(c.Action)
+	}
+
+	otherwise := func(fbr *fiber) (Value, *Exception) {
+		return Value{}, nil
+	}
+	if node.Default != nil {
+		otherwise = vm.compile(node.Default)
+	}
+
+	// a break inside a case only leaves the switch
+	run := func(fbr *fiber, action instruction) (Value, *Exception) {
+		v, exc := action(fbr)
+		if exc == breakSignal {
+			return Value{}, nil
+		}
+		return v, exc
+	}
+
+	// optimise: literal & enum cases become a jump table
+	if tag != nil {
+		table := map[caseKey]int{}
+		for i, c := range node.Cases {
+			for _, v := range c.Values {
+				literal, isValue := vm.evaluate(v).(Value)
+				if !isValue || (!isLiteral(v) && vm.enumCase(v) == nil) {
+					table = nil
+					break
+				}
+
+				key, ok := keyOf(literal)
+				if !ok {
+					table = nil
+					break
+				}
+
+				if _, exists := table[key]; exists {
+					panic(fmt.Errorf("duplicate case %v in switch on line %v", v, c.Line()))
+				}
+				table[key] = i
+			}
+
+			if table == nil {
+				break
+			}
+		}
+
+		if table != nil {
+			return func(fbr *fiber) (Value, *Exception) {
+				v, exc := tag(fbr)
+				if exc != nil {
+					return v, exc
+				}
+
+				if key, ok := keyOf(v); ok {
+					if i, exists := table[key]; exists {
+						return run(fbr, actions[i])
+					}
+				}
+				return run(fbr, otherwise)
+			}
+		}
+	}
+
+	// generic compilation
+	return func(fbr *fiber) (Value, *Exception) {
+		var subject Value
+		if tag != nil {
+			v, exc := tag(fbr)
+			if exc != nil {
+				return v, exc
+			}
+			subject = v
+		}
+
+		for i, values := range values {
+			for _, value := range values {
+				v, exc := value(fbr)
+				if exc != nil {
+					return v, exc
+				}
+
+				if (tag == nil && v.IsTruthy()) || (tag != nil && subject.Equals(v)) {
+					return run(fbr, actions[i])
+				}
+			}
+		}
+		return run(fbr, otherwise)
+	}
+}
+
+func (vm *Instance) emitSelect(node ast.Select) instruction {
+	closure := vm.cp.closures.Last(0)
+
+	// every task of every case is evaluated up front, in order
+	var values []instruction
+	var owners []int // the case each value belongs to
+	for i, c := range node.Cases {
+		for _, v := range c.Values {
+			values = append(values, vm.compile(v))
+			owners = append(owners, i)
+		}
+	}
+
+	if len(values) == 0 {
+		panic(fmt.Errorf("switch await on line %v requires at least one case", node.Line()))
+	}
+
+	closure.scope.OpenBlock()
+	defer closure.scope.CloseBlock()
+
+	index := -1
+	if node.Name != "" {
+		index, _ = closure.scope.Declare(node.Name, true)
+	}
+
+	actions := make([]instruction, len(node.Cases))
+	for i, c := range node.Cases {
+		actions[i] = vm.compile(c.Action)
+	}
+
+	var otherwise instruction
+	if node.Default != nil {
+		otherwise = vm.compile(node.Default)
+	}
+	fresh := index != -1 && closure.freeVars.Has(index)
+
+	return func(fbr *fiber) (Value, *Exception) {
+		tasks := make([]*task, len(values))
+		for i, value := range values {
+			v, exc := value(fbr)
+			if exc != nil {
+				return v, exc
+			}
+
+			task, ok := v.AsTask()
+			if !ok {
+				return Value{}, RuntimeExceptionF("cannot await on a value of type '%s'", v.TypeOf())
+			}
+			tasks[i] = task
+		}
+
+		i, response, exc := vm.awaitAny(fbr, tasks, otherwise == nil)
+		if exc != nil {
+			return Value{}, exc
+		}
+
+		action := otherwise
+		if i != -1 {
+			if response.err != nil {
+				return response.result, response.err
+			}
+
+			if index != -1 {
+				if fresh {
+					fbr.stack[fbr.base+index] = &Value{}
+				}
+				fbr.setLocal(index, response.result)
+			}
+			action = actions[owners[i]]
+		}
+
+		// a break inside a case only leaves the switch
+		v, exc := action(fbr)
+		if exc == breakSignal {
+			return Value{}, nil
+		}
+		return v, exc
+	}
+}
+
+// isLiteral reports whether node is written out as a literal in the source
+func isLiteral(node ast.Node) bool {
+	switch node.(type) {
+	case ast.Input[bool], ast.Input[int64], ast.Input[float64], ast.Input[string], ast.Input[struct{}]:
+		return true
+	}
+	return false
+}
+
+func (vm *Instance) emitFor(node ast.For) instruction {
+	closure := vm.cp.closures.Last(0)
+	closure.scope.OpenBlock()
+	defer closure.scope.CloseBlock()
+
+	// compile the source before the loop variables come into scope
+	var start, end, iterable instruction
+	if rng, isRange := node.Iterable.(ast.Range); isRange {
+		if node.Key != "" {
+			panic(fmt.Errorf("for loop on line %v cannot bind a key when iterating a range", node.Line()))
+		}
+		start, end = vm.compile(rng.Start), vm.compile(rng.End)
+	} else {
+		iterable = vm.compile(node.Iterable)
+	}
+
+	// a key named _ is discarded like in destructuring
+	keyIndex := -1
+	if node.Key != "" && node.Key != "_" {
+		var ok bool
+		if keyIndex, ok = closure.scope.Declare(node.Key, true); !ok {
+			panic(fmt.Errorf("double declaration of %s", node.Key))
+		}
+	}
+
+	valueIndex, ok := closure.scope.Declare(node.Value, true)
+	if !ok {
+		panic(fmt.Errorf("double declaration of %s", node.Value))
+	}
+
+	action := vm.metered(vm.compile(node.Action))
+
+	// captured loop variables get fresh boxes so every iteration is captured separately
+	fresh := closure.freeVars.Has(valueIndex) || (keyIndex != -1 && closure.freeVars.Has(keyIndex))
+
+	// runs one iteration and reports whether the loop should stop
+	body := func(fbr *fiber, key, value Value) (done bool, v Value, exc *Exception) {
+		// every iteration is a cancellation checkpoint
+		if exc := fbr.cancelled(); exc != nil {
+			return true, Value{}, exc
+		}
+
+		if fresh {
+			fbr.stack[fbr.base+valueIndex] = &Value{}
+			if keyIndex != -1 {
+				fbr.stack[fbr.base+keyIndex] = &Value{}
+			}
+		}
+
+		if keyIndex != -1 {
+			fbr.setLocal(keyIndex, key)
+		}
+		fbr.setLocal(valueIndex, value)
+
+		v, exc = action(fbr)
+		switch exc {
+		case nil, continueSignal:
+			return false, Value{}, nil
+		case breakSignal:
+			return true, Value{}, nil
+		}
+		return true, v, exc
+	}
+
+	// numeric ranges
+	if iterable == nil {
+		return func(fbr *fiber) (Value, *Exception) {
+			from, exc := start(fbr)
+			if exc != nil {
+				return from, exc
+			}
+
+			to, exc := end(fbr)
+			if exc != nil {
+				return to, exc
+			}
+
+			// integer bounds count in integers
+			if a, ok := from.AsInt64(); ok {
+				if b, ok := to.AsInt64(); ok {
+					for i := a; i < b; i++ {
+						if done, v, exc := body(fbr, Value{}, BoxInt(i)); done {
+							return v, exc
+						}
+					}
+					return Value{}, nil
+				}
+			}
+
+			a, ok := from.AsFloat64()
+			b, ok2 := to.AsFloat64()
+			if !ok || !ok2 {
+				return Value{}, TypeErrorF("range bounds must be numbers, got '%v' and '%v'", from.TypeOf(), to.TypeOf())
+			}
+
+			for i := a; i < b; i++ {
+				if done, v, exc := body(fbr, Value{}, BoxNumber(i)); done {
+					return v, exc
+				}
+			}
+			return Value{}, nil
+		}
+	}
+
+	return func(fbr *fiber) (Value, *Exception) {
+		source, exc := iterable(fbr)
+		if exc != nil {
+			return source, exc
+		}
+
+		if isKnown(source.pointer) {
+			return Value{}, TypeErrorF("cannot iterate over a value of type '%v'", source.TypeOf())
+		}
+
+		switch source.scalar {
+		case arrayType:
+			for i, elem := range *(*[]Value)(source.pointer) {
+				if done, v, exc := body(fbr, BoxInt(int64(i)), elem); done {
+					return v, exc
+				}
+			}
+
+		case stringType:
+			for i, r := range *(*string)(source.pointer) {
+				if done, v, exc := body(fbr, BoxInt(int64(i)), BoxString(string(r))); done {
+					return v, exc
+				}
+			}
+
+		case bufferType:
+			for i, b := range *(*[]byte)(source.pointer) {
+				if done, v, exc := body(fbr, BoxInt(int64(i)), BoxInt(int64(b))); done {
+					return v, exc
+				}
+			}
+
+		case mapType:
+			m := (*Map)(source.pointer)
+			// iterate over a snapshot so the body can safely modify the map
+			for _, key := range slices.Clone(m.keys) {
+				value, exists := m.Get(key)
+				if !exists {
+					continue
+				}
+
+				if done, v, exc := body(fbr, BoxString(key), value); done {
+					return v, exc
+				}
+			}
+
+		case generatorType:
+			// leaving the loop early stops the generator, an error raised by its deferred calls replaces the outcome
+			gen := (*Generator)(source.pointer)
+			for i := 0; ; i++ {
+				value, ok, exc := gen.resume(fbr.unsynced())
+				if exc != nil {
+					return Value{}, exc
+				}
+				if !ok {
+					break
+				}
+
+				if done, v, exc := body(fbr, BoxInt(int64(i)), value); done {
+					if stopExc := gen.stop(fbr.unsynced()); stopExc != nil && (exc == nil || exc.isSignal()) {
+						return Value{}, stopExc
+					}
+					return v, exc
+				}
+			}
+
+		case customType:
+			it, ok := (*(*CustomValue)(source.pointer)).(Iterable)
+			if !ok {
+				return Value{}, TypeErrorF("cannot iterate over a value of type '%v'", source.TypeOf())
+			}
+
+			for key, value := range it.Iterate() {
+				if done, v, exc := body(fbr, key, value); done {
+					return v, exc
+				}
+			}
+
+		default:
+			return Value{}, TypeErrorF("cannot iterate over a value of type '%v'", source.TypeOf())
+		}
+		return Value{}, nil
+	}
+}
+
+func (vm *Instance) emitBlock(node ast.Block) instruction {
+	vm.cp.closures.Last(0).scope.OpenBlock()
+	defer vm.cp.closures.Last(0).scope.CloseBlock()
+
+	// optimise: statement extraction from block; saves an extra dispatch
+	if len(node.Code) == 1 && vm.cp.inline {
+		node := node.Code[0]
+		// optimise: {return x}
+		if ret, isReturn := node.(ast.Return); isReturn {
+			// optimise: returning constants
+			if in, isInput := ret.Value.(ast.Input[int64]); isInput {
+				value := BoxInt(in.Value)
+				return func(fbr *fiber) (Value, *Exception) {
+					return value, returnSignal
+				}
+			}
+			if in, isInput := ret.Value.(ast.Input[float64]); isInput {
+				value := BoxNumber(in.Value)
+				return func(fbr *fiber) (Value, *Exception) {
+					return value, returnSignal
+				}
+			}
+
+			// optimise: returning locals
+			if iGet, isIdentGet := ret.Value.(ast.Ident); isIdentGet {
+				variable, err := vm.cp.reach(iGet.Name)
+				if err != nil {
+					panic(err)
+				}
+
+				if v, isLocal := variable.(local); isLocal {
+					if v.isCaptured {
+						return func(fbr *fiber) (Value, *Exception) {
+							return fbr.getCaptured(v.index), returnSignal
+						}
+					}
+					return func(fbr *fiber) (Value, *Exception) {
+						return fbr.getLocal(v.index), returnSignal
+					}
+				}
+			}
+
+			what := vm.compile(ret.Value)
+			return func(fbr *fiber) (Value, *Exception) {
+				v, err := what(fbr)
+				if err != nil {
+					return v, err
+				}
+
+				return v, returnSignal
+			}
+		}
+
+		// generic
+		return vm.compile(node)
+	}
+
+	block := make([]instruction, len(node.Code))
+	for i, statement := range node.Code {
+		block[i] = vm.compile(statement)
+	}
+
+	return func(fbr *fiber) (Value, *Exception) {
+		for _, statement := range block {
 			if v, err := statement(fbr); err != nil {
 				return v, err
 			}
@@ -1286,6 +2618,22 @@ func (vm *Instance) emitBlock(node ast.Block) instruction {
 func (vm *Instance) emitFieldAccess(node ast.FieldAccess) instruction {
 	index := fields.Get(node.Rhs)
 
+	// private symbols & symbols withheld by the import policy are reported at compile time
+	if iGet, isIdentGet := node.Lhs.(ast.Ident); isIdentGet {
+		if global, err := vm.cp.reach(iGet.Name); err == nil {
+			if global, isGlobal := global.(Global); isGlobal && global.IsStatic {
+				if pkg, ok := global.Value.asPackage(); ok {
+					if reason, blocked := pkg.blocked[index]; blocked {
+						panic(fmt.Errorf("'%v.%v' on line %v is not allowed by the import policy, %v", iGet.Name, node.Rhs, node.Line(), reason))
+					}
+					if symbol, exists := pkg.globals[index]; exists && !symbol.IsPublic {
+						panic(fmt.Errorf("'%v.%v' on line %v is private to package '%v', declare it with 'pub' to export it", iGet.Name, node.Rhs, node.Line(), pkg.name))
+					}
+				}
+			}
+		}
+	}
+
 	// optimise: ident as lhs
 	if lhs := vm.evaluate(node.Lhs); lhs != nil {
 		switch lhs := lhs.(type) {
@@ -1299,6 +2647,24 @@ func (vm *Instance) emitFieldAccess(node ast.FieldAccess) instruction {
 			}
 
 		case Value:
+			// maps & records are mutable so their fields can never be resolved at compile time
+			_, isMap := lhs.AsMap()
+			if _, isRecord := lhs.AsRecord(); isMap || isRecord {
+				return func(fbr *fiber) (Value, *Exception) {
+					field, _ := lhs.getField(index)
+					return field, nil
+				}
+			}
+
+			// variable bindings of packages have to be read every time
+			if pkg, isPackage := lhs.asPackage(); isPackage {
+				if global, exists := pkg.globals[index]; exists && global.IsPublic && !global.IsStatic {
+					return func(fbr *fiber) (Value, *Exception) {
+						return *global.Value, nil
+					}
+				}
+			}
+
 			// I don't think this gets used tbh because using vm.evaluate(ast.FieldAccess) bypasses this
 			if field, exists := lhs.getField(index); exists {
 				return func(fbr *fiber) (Value, *Exception) {
@@ -1334,6 +2700,77 @@ func (vm *Instance) emitFieldAccess(node ast.FieldAccess) instruction {
 	}
 }
 
+func (vm *Instance) emitArray(node ast.Array) instruction {
+	elements := make([]instruction, len(node.Elements))
+	for i, elem := range node.Elements {
+		elements[i] = vm.compile(elem)
+	}
+
+	return func(fbr *fiber) (Value, *Exception) {
+		array := make([]Value, len(elements))
+		for i, elem := range elements {
+			v, exc := elem(fbr)
+			if exc != nil {
+				return v, exc
+			}
+			array[i] = v
+		}
+		return BoxArray(array), nil
+	}
+}
+
+func (vm *Instance) emitMap(node ast.Map) instruction {
+	values := make([]instruction, len(node.Values))
+	for i, value := range node.Values {
+		values[i] = vm.compile(value)
+	}
+
+	return func(fbr *fiber) (Value, *Exception) {
+		m := NewMap(len(values))
+		for i, value := range values {
+			v, exc := value(fbr)
+			if exc != nil {
+				return v, exc
+			}
+			m.Set(node.Keys[i], v)
+		}
+		return BoxMap(m), nil
+	}
+}
+
+func (vm *Instance) emitIndex(node ast.Index) instruction {
+	// optimise: indexing a local with a local or a constant
+	if lhs, isLocal := vm.evaluate(node.Lhs).(local); isLocal {
+		switch index := vm.evaluate(node.Index).(type) {
+		case local:
+			return func(fbr *fiber) (Value, *Exception) {
+				return fbr.get(lhs).index(*fbr.get(index))
+			}
+		case Value:
+			return func(fbr *fiber) (Value, *Exception) {
+				return fbr.get(lhs).index(index)
+			}
+		}
+	}
+
+	// generic compilation
+	lhs := vm.compile(node.Lhs)
+	index := vm.compile(node.Index)
+	return func(fbr *fiber) (Value, *Exception) {
+		lhs, exc := lhs(fbr)
+		if exc != nil {
+			return lhs, exc
+		}
+
+		index, exc := index(fbr)
+		if exc != nil {
+			return index, exc
+		}
+
+		return lhs.index(index)
+	}
+}
+
 func (vm *Instance) emitNeg(node ast.Neg) instruction {
 	value := vm.compile(node.Value)
 
@@ -1343,13 +2780,84 @@ func (vm *Instance) emitNeg(node ast.Neg) instruction {
 			return value, exc
 		}
 
-		if float, ok := value.AsFloat64(); ok {
+		if i, ok := value.AsInt64(); ok {
+			return BoxInt(-i), nil
+		} else if float, ok := value.AsFloat64(); ok {
 			return BoxNumber(-float), nil
 		}
 		return Value{}, RuntimeExceptionF("Cannot negate '%v'.", value)
 	}
 }
 
+func (vm *Instance) emitNot(node ast.Not) instruction {
+	// optimise: negating a local e.g. !done
+	if v, isLocal := vm.evaluate(node.Value).(local); isLocal {
+		return func(fbr *fiber) (Value, *Exception) {
+			return BoxBool(!fbr.get(v).IsTruthy()), nil
+		}
+	}
+
+	value := vm.compile(node.Value)
+	return func(fbr *fiber) (Value, *Exception) {
+		value, exc := value(fbr)
+		if exc != nil {
+			return value, exc
+		}
+		return BoxBool(!value.IsTruthy()), nil
+	}
+}
+
+func (vm *Instance) emitBitNot(node ast.BitNot) instruction {
+	value := vm.compile(node.Value)
+
+	return func(fbr *fiber) (Value, *Exception) {
+		value, exc := value(fbr)
+		if exc != nil {
+			return value, exc
+		}
+
+		if i, ok := value.AsInt64(); ok {
+			return BoxInt(^i), nil
+		}
+		return Value{}, RuntimeExceptionF("cannot apply '~' operator on a '%v'.", value.TypeOf())
+	}
+}
+
+func (vm *Instance) emitTypeTest(node ast.TypeTest) instruction {
+	value := vm.compile(node.Value)
+
+	var test func(v Value) bool
+	switch node.Type {
+	case "function":
+		// user functions, Go functions and methods are all callable
+		test = func(v Value) bool {
+			return !isKnown(v.pointer) && (v.scalar == userFnType || v.scalar == goFuncType || v.scalar == methodType)
+		}
+	case "error":
+		test = func(v Value) bool {
+			_, ok := v.AsError()
+			return ok
+		}
+	case "number":
+		// integers & floats are both numbers
+		test = func(v Value) bool {
+			return v.pointer == i64Type || v.pointer == f64Type
+		}
+	default:
+		test = func(v Value) bool {
+			return v.TypeOf() == node.Type
+		}
+	}
+
+	return func(fbr *fiber) (Value, *Exception) {
+		v, exc := value(fbr)
+		if exc != nil {
+			return v, exc
+		}
+		return BoxBool(test(v)), nil
+	}
+}
+
 func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 	/*
 		1. Local x Local
@@ -1372,85 +2880,136 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							if result, ok := lhs.Add(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("+", lhs, rhs)
+							return mixed("+", lhs, rhs)
 						}
 
 					case ast.SubOp:
 						return func(fbr *fiber) (Value, *Exception) {
 							lhs, rhs := *fbr.get(lhs), *fbr.get(rhs)
-							if result, ok := lhs.Sub(rhs); ok {
+							if result, ok := lhs.Sub(rhs); ok {
+								return result, nil
+							}
+							return mixed("-", lhs, rhs)
+						}
+
+					case ast.MulOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							lhs, rhs := *fbr.get(lhs), *fbr.get(rhs)
+							if result, ok := lhs.Mul(rhs); ok {
+								return result, nil
+							}
+							return mixed("*", lhs, rhs)
+						}
+
+					case ast.DivOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							lhs, rhs := *fbr.get(lhs), *fbr.get(rhs)
+							if result, ok := lhs.Div(rhs); ok {
+								return result, nil
+							}
+							return mixed("/", lhs, rhs)
+						}
+
+					case ast.ModOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							lhs, rhs := *fbr.get(lhs), *fbr.get(rhs)
+							if result, ok := lhs.Mod(rhs); ok {
+								return result, nil
+							}
+							return mixed("%", lhs, rhs)
+						}
+
+					case ast.EqOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							lhs, rhs := *fbr.get(lhs), *fbr.get(rhs)
+							return BoxBool(lhs.Equals(rhs)), nil
+						}
+
+					case ast.NeqOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							lhs, rhs := *fbr.get(lhs), *fbr.get(rhs)
+							return BoxBool(!lhs.Equals(rhs)), nil
+						}
+
+					case ast.LtOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							lhs, rhs := *fbr.get(lhs), *fbr.get(rhs)
+							if result, ok := lhs.LessThan(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("-", lhs, rhs)
+							return mixed("<", lhs, rhs)
 						}
 
-					case ast.MulOp:
+					case ast.GtOp:
 						return func(fbr *fiber) (Value, *Exception) {
 							lhs, rhs := *fbr.get(lhs), *fbr.get(rhs)
-							if result, ok := lhs.Mul(rhs); ok {
+							if result, ok := lhs.GreaterThan(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("*", lhs, rhs)
+							return mixed(">", lhs, rhs)
 						}
 
-					case ast.DivOp:
+					case ast.LtEqOp:
 						return func(fbr *fiber) (Value, *Exception) {
 							lhs, rhs := *fbr.get(lhs), *fbr.get(rhs)
-							if result, ok := lhs.Mul(rhs); ok {
+							if result, ok := lhs.LessThanOrEqualTo(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("/", lhs, rhs)
+							return mixed("<=", lhs, rhs)
 						}
 
-					case ast.ModOp:
+					case ast.GtEqOp:
 						return func(fbr *fiber) (Value, *Exception) {
 							lhs, rhs := *fbr.get(lhs), *fbr.get(rhs)
-							if result, ok := lhs.Mod(rhs); ok {
+							if result, ok := lhs.GreaterThanOrEqualTo(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("%", lhs, rhs)
+							return mixed(">=", lhs, rhs)
 						}
 
-					case ast.EqOp:
+					case ast.BitAndOp:
 						return func(fbr *fiber) (Value, *Exception) {
 							lhs, rhs := *fbr.get(lhs), *fbr.get(rhs)
-							return BoxBool(lhs.Equals(rhs)), nil
+							if result, ok := lhs.BitAnd(rhs); ok {
+								return result, nil
+							}
+							return Value{}, operatorError("&", lhs, rhs)
 						}
 
-					case ast.LtOp:
+					case ast.BitOrOp:
 						return func(fbr *fiber) (Value, *Exception) {
 							lhs, rhs := *fbr.get(lhs), *fbr.get(rhs)
-							if result, ok := lhs.LessThan(rhs); ok {
+							if result, ok := lhs.BitOr(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("<", lhs, rhs)
+							return Value{}, operatorError("|", lhs, rhs)
 						}
 
-					case ast.GtOp:
+					case ast.BitXorOp:
 						return func(fbr *fiber) (Value, *Exception) {
 							lhs, rhs := *fbr.get(lhs), *fbr.get(rhs)
-							if result, ok := lhs.GreaterThan(rhs); ok {
+							if result, ok := lhs.BitXor(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError(">", lhs, rhs)
+							return Value{}, operatorError("^", lhs, rhs)
 						}
 
-					case ast.LtEqOp:
+					case ast.ShlOp:
 						return func(fbr *fiber) (Value, *Exception) {
 							lhs, rhs := *fbr.get(lhs), *fbr.get(rhs)
-							if result, ok := lhs.LessThanOrEqualTo(rhs); ok {
+							if result, ok := lhs.Shl(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("<=", lhs, rhs)
+							return Value{}, operatorError("<<", lhs, rhs)
 						}
 
-					case ast.GtEqOp:
+					case ast.ShrOp:
 						return func(fbr *fiber) (Value, *Exception) {
 							lhs, rhs := *fbr.get(lhs), *fbr.get(rhs)
-							if result, ok := lhs.GreaterThanOrEqualTo(rhs); ok {
+							if result, ok := lhs.Shr(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError(">=", lhs, rhs)
+							return Value{}, operatorError(">>", lhs, rhs)
 						}
 
 					case ast.OrOp:
@@ -1479,7 +3038,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							if result, ok := lhs.Add(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("+", lhs, rhs)
+							return mixed("+", lhs, rhs)
 						}
 
 					case ast.SubOp:
@@ -1488,7 +3047,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							if result, ok := lhs.Sub(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("-", lhs, rhs)
+							return mixed("-", lhs, rhs)
 						}
 
 					case ast.MulOp:
@@ -1497,7 +3056,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							if result, ok := lhs.Mul(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("*", lhs, rhs)
+							return mixed("*", lhs, rhs)
 						}
 
 					case ast.DivOp:
@@ -1506,16 +3065,16 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							if result, ok := lhs.Div(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("/", lhs, rhs)
+							return mixed("/", lhs, rhs)
 						}
 
 					case ast.ModOp:
 						return func(fbr *fiber) (Value, *Exception) {
 							lhs := *fbr.get(lhs)
-							if result, ok := lhs.Div(rhs); ok {
+							if result, ok := lhs.Mod(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("%", lhs, rhs)
+							return mixed("%", lhs, rhs)
 						}
 
 					case ast.EqOp:
@@ -1524,13 +3083,19 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							return BoxBool(lhs.Equals(rhs)), nil
 						}
 
+					case ast.NeqOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							lhs := fbr.get(lhs)
+							return BoxBool(!lhs.Equals(rhs)), nil
+						}
+
 					case ast.LtOp:
 						return func(fbr *fiber) (Value, *Exception) {
 							lhs := *fbr.get(lhs)
 							if result, ok := lhs.LessThan(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("<", lhs, rhs)
+							return mixed("<", lhs, rhs)
 						}
 
 					case ast.GtOp:
@@ -1539,7 +3104,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							if result, ok := lhs.GreaterThan(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("<", lhs, rhs)
+							return mixed(">", lhs, rhs)
 						}
 
 					case ast.LtEqOp:
@@ -1548,7 +3113,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							if result, ok := lhs.LessThanOrEqualTo(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("<=", lhs, rhs)
+							return mixed("<=", lhs, rhs)
 						}
 
 					case ast.GtEqOp:
@@ -1557,7 +3122,52 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							if result, ok := lhs.GreaterThanOrEqualTo(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError(">=", lhs, rhs)
+							return mixed(">=", lhs, rhs)
+						}
+
+					case ast.BitAndOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							lhs := *fbr.get(lhs)
+							if result, ok := lhs.BitAnd(rhs); ok {
+								return result, nil
+							}
+							return Value{}, operatorError("&", lhs, rhs)
+						}
+
+					case ast.BitOrOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							lhs := *fbr.get(lhs)
+							if result, ok := lhs.BitOr(rhs); ok {
+								return result, nil
+							}
+							return Value{}, operatorError("|", lhs, rhs)
+						}
+
+					case ast.BitXorOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							lhs := *fbr.get(lhs)
+							if result, ok := lhs.BitXor(rhs); ok {
+								return result, nil
+							}
+							return Value{}, operatorError("^", lhs, rhs)
+						}
+
+					case ast.ShlOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							lhs := *fbr.get(lhs)
+							if result, ok := lhs.Shl(rhs); ok {
+								return result, nil
+							}
+							return Value{}, operatorError("<<", lhs, rhs)
+						}
+
+					case ast.ShrOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							lhs := *fbr.get(lhs)
+							if result, ok := lhs.Shr(rhs); ok {
+								return result, nil
+							}
+							return Value{}, operatorError(">>", lhs, rhs)
 						}
 					}
 				}
@@ -1573,7 +3183,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							if result, ok := lhs.Add(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("+", lhs, rhs)
+							return mixed("+", lhs, rhs)
 						}
 
 					case ast.SubOp:
@@ -1582,7 +3192,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							if result, ok := lhs.Sub(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("-", lhs, rhs)
+							return mixed("-", lhs, rhs)
 						}
 
 					case ast.MulOp:
@@ -1591,7 +3201,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							if result, ok := lhs.Mul(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("*", lhs, rhs)
+							return mixed("*", lhs, rhs)
 						}
 
 					case ast.DivOp:
@@ -1600,16 +3210,16 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							if result, ok := lhs.Div(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("/", lhs, rhs)
+							return mixed("/", lhs, rhs)
 						}
 
 					case ast.ModOp:
 						return func(fbr *fiber) (Value, *Exception) {
 							rhs := *fbr.get(rhs)
-							if result, ok := lhs.Div(rhs); ok {
+							if result, ok := lhs.Mod(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("%", lhs, rhs)
+							return mixed("%", lhs, rhs)
 						}
 
 					case ast.EqOp:
@@ -1618,13 +3228,19 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							return BoxBool(lhs.Equals(rhs)), nil
 						}
 
+					case ast.NeqOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							rhs := *fbr.get(rhs)
+							return BoxBool(!lhs.Equals(rhs)), nil
+						}
+
 					case ast.LtOp:
 						return func(fbr *fiber) (Value, *Exception) {
 							rhs := *fbr.get(rhs)
 							if result, ok := lhs.LessThan(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("<", lhs, rhs)
+							return mixed("<", lhs, rhs)
 						}
 
 					case ast.GtOp:
@@ -1633,7 +3249,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							if result, ok := lhs.GreaterThan(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("<", lhs, rhs)
+							return mixed(">", lhs, rhs)
 						}
 
 					case ast.LtEqOp:
@@ -1642,7 +3258,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							if result, ok := lhs.LessThanOrEqualTo(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError("<=", lhs, rhs)
+							return mixed("<=", lhs, rhs)
 						}
 
 					case ast.GtEqOp:
@@ -1651,7 +3267,52 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 							if result, ok := lhs.GreaterThanOrEqualTo(rhs); ok {
 								return result, nil
 							}
-							return Value{}, operatorError(">=", lhs, rhs)
+							return mixed(">=", lhs, rhs)
+						}
+
+					case ast.BitAndOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							rhs := *fbr.get(rhs)
+							if result, ok := lhs.BitAnd(rhs); ok {
+								return result, nil
+							}
+							return Value{}, operatorError("&", lhs, rhs)
+						}
+
+					case ast.BitOrOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							rhs := *fbr.get(rhs)
+							if result, ok := lhs.BitOr(rhs); ok {
+								return result, nil
+							}
+							return Value{}, operatorError("|", lhs, rhs)
+						}
+
+					case ast.BitXorOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							rhs := *fbr.get(rhs)
+							if result, ok := lhs.BitXor(rhs); ok {
+								return result, nil
+							}
+							return Value{}, operatorError("^", lhs, rhs)
+						}
+
+					case ast.ShlOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							rhs := *fbr.get(rhs)
+							if result, ok := lhs.Shl(rhs); ok {
+								return result, nil
+							}
+							return Value{}, operatorError("<<", lhs, rhs)
+						}
+
+					case ast.ShrOp:
+						return func(fbr *fiber) (Value, *Exception) {
+							rhs := *fbr.get(rhs)
+							if result, ok := lhs.Shr(rhs); ok {
+								return result, nil
+							}
+							return Value{}, operatorError(">>", lhs, rhs)
 						}
 					}
 				}
@@ -1677,7 +3338,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 			if result, ok := a.Add(b); ok {
 				return result, nil
 			}
-			return Value{}, operatorError("+", a, b)
+			return mixed("+", a, b)
 		}
 
 	case ast.SubOp:
@@ -1693,7 +3354,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 			if result, ok := a.Sub(b); ok {
 				return result, nil
 			}
-			return Value{}, operatorError("-", a, b)
+			return mixed("-", a, b)
 		}
 
 	case ast.MulOp:
@@ -1709,7 +3370,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 			if result, ok := a.Mul(b); ok {
 				return result, nil
 			}
-			return Value{}, operatorError("*", a, b)
+			return mixed("*", a, b)
 		}
 
 	case ast.DivOp:
@@ -1725,7 +3386,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 			if result, ok := a.Div(b); ok {
 				return result, nil
 			}
-			return Value{}, operatorError("/", a, b)
+			return mixed("/", a, b)
 		}
 
 	case ast.ModOp:
@@ -1741,7 +3402,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 			if result, ok := a.Mod(b); ok {
 				return result, nil
 			}
-			return Value{}, operatorError("%", a, b)
+			return mixed("%", a, b)
 		}
 
 	case ast.EqOp:
@@ -1757,6 +3418,19 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 			return BoxBool(a.Equals(b)), nil
 		}
 
+	case ast.NeqOp:
+		return func(fbr *fiber) (Value, *Exception) {
+			a, err := lhs(fbr)
+			if err != nil {
+				return a, err
+			}
+			b, err := rhs(fbr)
+			if err != nil {
+				return a, err
+			}
+			return BoxBool(!a.Equals(b)), nil
+		}
+
 	case ast.LtOp:
 		return func(fbr *fiber) (Value, *Exception) {
 			a, err := lhs(fbr)
@@ -1770,7 +3444,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 			if result, ok := a.LessThan(b); ok {
 				return result, nil
 			}
-			return Value{}, operatorError("<", a, b)
+			return mixed("<", a, b)
 		}
 
 	case ast.GtOp:
@@ -1786,7 +3460,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 			if result, ok := a.GreaterThan(b); ok {
 				return result, nil
 			}
-			return Value{}, operatorError(">", a, b)
+			return mixed(">", a, b)
 		}
 
 	case ast.LtEqOp:
@@ -1802,7 +3476,7 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 			if result, ok := a.LessThanOrEqualTo(b); ok {
 				return result, nil
 			}
-			return Value{}, operatorError("<=", a, b)
+			return mixed("<=", a, b)
 		}
 
 	case ast.GtEqOp:
@@ -1818,7 +3492,87 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 			if result, ok := a.GreaterThanOrEqualTo(b); ok {
 				return result, nil
 			}
-			return Value{}, operatorError(">=", a, b)
+			return mixed(">=", a, b)
+		}
+
+	case ast.BitAndOp:
+		return func(fbr *fiber) (Value, *Exception) {
+			a, err := lhs(fbr)
+			if err != nil {
+				return a, err
+			}
+			b, err := rhs(fbr)
+			if err != nil {
+				return a, err
+			}
+			if result, ok := a.BitAnd(b); ok {
+				return result, nil
+			}
+			return Value{}, operatorError("&", a, b)
+		}
+
+	case ast.BitOrOp:
+		return func(fbr *fiber) (Value, *Exception) {
+			a, err := lhs(fbr)
+			if err != nil {
+				return a, err
+			}
+			b, err := rhs(fbr)
+			if err != nil {
+				return a, err
+			}
+			if result, ok := a.BitOr(b); ok {
+				return result, nil
+			}
+			return Value{}, operatorError("|", a, b)
+		}
+
+	case ast.BitXorOp:
+		return func(fbr *fiber) (Value, *Exception) {
+			a, err := lhs(fbr)
+			if err != nil {
+				return a, err
+			}
+			b, err := rhs(fbr)
+			if err != nil {
+				return a, err
+			}
+			if result, ok := a.BitXor(b); ok {
+				return result, nil
+			}
+			return Value{}, operatorError("^", a, b)
+		}
+
+	case ast.ShlOp:
+		return func(fbr *fiber) (Value, *Exception) {
+			a, err := lhs(fbr)
+			if err != nil {
+				return a, err
+			}
+			b, err := rhs(fbr)
+			if err != nil {
+				return a, err
+			}
+			if result, ok := a.Shl(b); ok {
+				return result, nil
+			}
+			return Value{}, operatorError("<<", a, b)
+		}
+
+	case ast.ShrOp:
+		return func(fbr *fiber) (Value, *Exception) {
+			a, err := lhs(fbr)
+			if err != nil {
+				return a, err
+			}
+			b, err := rhs(fbr)
+			if err != nil {
+				return a, err
+			}
+			if result, ok := a.Shr(b); ok {
+				return result, nil
+			}
+			return Value{}, operatorError(">>", a, b)
 		}
 
 	case ast.OrOp:
@@ -1858,7 +3612,10 @@ func (vm *Instance) emitBinOp(node ast.BinOp) instruction {
 }
 
 func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
-	if lhs := vm.evaluate(node.Lhs); lhs != nil {
+	// concatenating strings allocates, so with a memory limit x += y is left to the paths below which account for it
+	charged := node.Operator == ast.AddOp && vm.rt.maxMemory != 0
+
+	if lhs := vm.evaluate(node.Lhs); lhs != nil && !charged {
 		if rhs := vm.evaluate(node.Rhs); rhs != nil {
 			// optimise: lhs being a local
 			if lhs, ok := lhs.(local); ok {
@@ -1877,7 +3634,7 @@ func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
 								*lhs = result
 								return Value{}, nil
 							}
-							return Value{}, operatorError("+", *lhs, rhs)
+							return Value{}, mixedInto("+", lhs, rhs)
 						}
 
 					case ast.SubOp:
@@ -1888,7 +3645,7 @@ func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
 								*lhs = result
 								return Value{}, nil
 							}
-							return Value{}, operatorError("-", *lhs, rhs)
+							return Value{}, mixedInto("-", lhs, rhs)
 						}
 
 					case ast.MulOp:
@@ -1899,7 +3656,7 @@ func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
 								*lhs = result
 								return Value{}, nil
 							}
-							return Value{}, operatorError("*", *lhs, rhs)
+							return Value{}, mixedInto("*", lhs, rhs)
 						}
 
 					case ast.DivOp:
@@ -1910,7 +3667,7 @@ func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
 								*lhs = result
 								return Value{}, nil
 							}
-							return Value{}, operatorError("/", *lhs, rhs)
+							return Value{}, mixedInto("/", lhs, rhs)
 						}
 
 					case ast.ModOp:
@@ -1921,7 +3678,7 @@ func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
 								*lhs = result
 								return Value{}, nil
 							}
-							return Value{}, operatorError("%", *lhs, rhs)
+							return Value{}, mixedInto("%", lhs, rhs)
 						}
 					}
 				}
@@ -1936,7 +3693,7 @@ func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
 								*lhs = result
 								return Value{}, nil
 							}
-							return Value{}, operatorError("+", *lhs, rhs)
+							return Value{}, mixedInto("+", lhs, rhs)
 						}
 
 					case ast.SubOp:
@@ -1946,7 +3703,7 @@ func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
 								*lhs = result
 								return Value{}, nil
 							}
-							return Value{}, operatorError("-", *lhs, rhs)
+							return Value{}, mixedInto("-", lhs, rhs)
 						}
 
 					case ast.MulOp:
@@ -1956,7 +3713,7 @@ func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
 								*lhs = result
 								return Value{}, nil
 							}
-							return Value{}, operatorError("*", *lhs, rhs)
+							return Value{}, mixedInto("*", lhs, rhs)
 						}
 
 					case ast.DivOp:
@@ -1966,7 +3723,7 @@ func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
 								*lhs = result
 								return Value{}, nil
 							}
-							return Value{}, operatorError("/", *lhs, rhs)
+							return Value{}, mixedInto("/", lhs, rhs)
 						}
 
 					case ast.ModOp:
@@ -1976,7 +3733,7 @@ func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
 								*lhs = result
 								return Value{}, nil
 							}
-							return Value{}, operatorError("%", *lhs, rhs)
+							return Value{}, mixedInto("%", lhs, rhs)
 						}
 					}
 				}
@@ -2002,7 +3759,7 @@ func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
 						*lhs = result
 						return Value{}, nil
 					}
-					return Value{}, operatorError("+", *lhs, rhs)
+					return Value{}, mixedInto("+", lhs, rhs)
 				}
 
 			case ast.SubOp:
@@ -2015,7 +3772,7 @@ func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
 						*lhs = result
 						return Value{}, nil
 					}
-					return Value{}, operatorError("-", *lhs, rhs)
+					return Value{}, mixedInto("-", lhs, rhs)
 				}
 
 			case ast.MulOp:
@@ -2028,7 +3785,7 @@ func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
 						*lhs = result
 						return Value{}, nil
 					}
-					return Value{}, operatorError("*", *lhs, rhs)
+					return Value{}, mixedInto("*", lhs, rhs)
 				}
 
 			case ast.DivOp:
@@ -2041,7 +3798,7 @@ func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
 						*lhs = result
 						return Value{}, nil
 					}
-					return Value{}, operatorError("/", *lhs, rhs)
+					return Value{}, mixedInto("/", lhs, rhs)
 				}
 
 			case ast.ModOp:
@@ -2054,97 +3811,101 @@ func (vm *Instance) emitMutableBinOp(node ast.MutableBinOp) instruction {
 						*lhs = result
 						return Value{}, nil
 					}
-					return Value{}, operatorError("%", *lhs, rhs)
+					return Value{}, mixedInto("%", lhs, rhs)
 				}
 			}
 		}
 	}
 
-	/* lhs := vm.compile(node.Lhs)
-	rhs := vm.compile(node.Rhs)
+	switch lhs := node.Lhs.(type) {
+	case ast.Ident:
+		// a variable is read & written without side effects so x op= y is just x = x op y
+		return vm.emitAssign(ast.Assign{Pos: node.Pos, Lhs: lhs, Value: ast.BinOp{Pos: node.Pos, Operator: node.Operator, Lhs: lhs, Rhs: node.Rhs}})
 
-	// generic compilation
-	switch node.Operator {
-	case ast.AddOp:
-		return func(fbr *fiber) (Value, *Exception) {
-			a, err := lhs(fbr)
-			if err != nil {
-				return a, err
-			}
-			b, err := rhs(fbr)
-			if err != nil {
-				return a, err
-			}
-			if result, ok := a.Add(b); ok {
-				return result, nil
-			}
-			return Value{}, operatorError("+", a, b)
+	case ast.FieldAccess:
+		// same goes for fields of variables e.g. p.x += dx, which also covers fields of packages
+		if _, isIdent := lhs.Lhs.(ast.Ident); isIdent {
+			return vm.emitAssign(ast.Assign{Pos: node.Pos, Lhs: lhs, Value: ast.BinOp{Pos: node.Pos, Operator: node.Operator, Lhs: lhs, Rhs: node.Rhs}})
 		}
 
-	case ast.SubOp:
+		// generic compilation: the object is evaluated only once
+		object := vm.compile(lhs.Lhs)
+		rhs := vm.compile(node.Rhs)
+		index := fields.Get(lhs.Rhs)
 		return func(fbr *fiber) (Value, *Exception) {
-			a, err := lhs(fbr)
-			if err != nil {
-				return a, err
+			object, exc := object(fbr)
+			if exc != nil {
+				return object, exc
 			}
-			b, err := rhs(fbr)
-			if err != nil {
-				return a, err
+
+			field, exists := object.getField(index)
+			if !exists {
+				return Value{}, RuntimeExceptionF("undefined symbol '%v' in '%v'", lhs.Rhs, lhs)
 			}
-			if result, ok := a.Sub(b); ok {
-				return result, nil
+
+			rhs, exc := rhs(fbr)
+			if exc != nil {
+				return rhs, exc
 			}
-			return Value{}, operatorError("-", a, b)
-		}
 
-	case ast.MulOp:
-		return func(fbr *fiber) (Value, *Exception) {
-			a, err := lhs(fbr)
-			if err != nil {
-				return a, err
+			result, exc := operate(node.Operator, field, rhs)
+			if exc != nil {
+				return result, exc
 			}
-			b, err := rhs(fbr)
-			if err != nil {
-				return a, err
+			if charged {
+				if exc := vm.charge(sizeOf(result)); exc != nil {
+					return Value{}, exc
+				}
 			}
-			if result, ok := a.Mul(b); ok {
-				return result, nil
+
+			if exc := vm.chargeEntry(object, BoxString(lhs.Rhs)); exc != nil {
+				return Value{}, exc
 			}
-			return Value{}, operatorError("*", a, b)
+			return Value{}, object.setField(index, result)
 		}
 
-	case ast.DivOp:
+	case ast.Index:
+		// generic compilation: the collection & the index are evaluated only once
+		object := vm.compile(lhs.Lhs)
+		index := vm.compile(lhs.Index)
+		rhs := vm.compile(node.Rhs)
 		return func(fbr *fiber) (Value, *Exception) {
-			a, err := lhs(fbr)
-			if err != nil {
-				return a, err
+			object, exc := object(fbr)
+			if exc != nil {
+				return object, exc
 			}
-			b, err := rhs(fbr)
-			if err != nil {
-				return a, err
+
+			index, exc := index(fbr)
+			if exc != nil {
+				return index, exc
 			}
-			if result, ok := a.Div(b); ok {
-				return result, nil
+
+			element, exc := object.index(index)
+			if exc != nil {
+				return element, exc
 			}
-			return Value{}, operatorError("/", a, b)
-		}
 
-	case ast.ModOp:
-		return func(fbr *fiber) (Value, *Exception) {
-			a, err := lhs(fbr)
-			if err != nil {
-				return a, err
+			rhs, exc := rhs(fbr)
+			if exc != nil {
+				return rhs, exc
 			}
-			b, err := rhs(fbr)
-			if err != nil {
-				return a, err
+
+			result, exc := operate(node.Operator, element, rhs)
+			if exc != nil {
+				return result, exc
 			}
-			if result, ok := a.Mod(b); ok {
-				return result, nil
+			if charged {
+				if exc := vm.charge(sizeOf(result)); exc != nil {
+					return Value{}, exc
+				}
+			}
+
+			if exc := vm.chargeEntry(object, index); exc != nil {
+				return Value{}, exc
 			}
-			return Value{}, operatorError("%", a, b)
+			return Value{}, object.setIndex(index, result)
 		}
-	} */
+	}
 
-	panic(fmt.Errorf("implement Operator(%v) in %v", node.Operator, node))
+	panic(fmt.Errorf("cannot assign to '%v' on line %v", node.Lhs, node.Line()))
 }
@@ -0,0 +1,130 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hxkhan/evie/ast"
+	"github.com/hxkhan/evie/vm/fields"
+)
+
+// enumInfo describes an enum, its members are the only values of its type
+type enumInfo struct {
+	name    string
+	members []*enumMember // in the order they were declared
+}
+
+// enumMember is a named constant of an enum, each one is only equal to itself
+type enumMember struct {
+	enum *enumInfo
+	name string
+}
+
+func (m *enumMember) String() string {
+	return m.enum.name + "." + m.name
+}
+
+// newEnum creates the value an enum is declared as; its members are the members of the enum
+// & calling it with the name of a member gives back that member e.g. Status("Active")
+func newEnum(node ast.Enum) Value {
+	enum := &enumInfo{name: node.Name, members: make([]*enumMember, len(node.Members))}
+	members := make(map[fields.ID]*Value, len(node.Members))
+	for i, name := range node.Members {
+		enum.members[i] = &enumMember{enum: enum, name: name}
+		members[fields.Get(name)] = boxEnum(enum.members[i]).Allocate()
+	}
+
+	namespace := BoxGoFunc(func(name Value) (Value, *Exception) {
+		if str, ok := name.AsString(); ok {
+			for _, m := range enum.members {
+				if m.name == str {
+					return boxEnum(m), nil
+				}
+			}
+		}
+		return Value{}, CustomError("'%v' is not a member of enum '%v'", name, enum.name)
+	})
+
+	gf, _ := namespace.AsGoFunc()
+	gf.members = members
+	return namespace
+}
+
+// enumCase resolves a switch case like Status.Active or pkg.Status.Active to the member it names,
+// nil if it is anything else; this works with & without inlining
+func (vm *Instance) enumCase(node ast.Node) *enumMember {
+	fa, isFieldAccess := node.(ast.FieldAccess)
+	if !isFieldAccess {
+		return nil
+	}
+
+	var namespace *Value
+	switch lhs := fa.Lhs.(type) {
+	case ast.Ident:
+		ref, err := vm.cp.reach(lhs.Name)
+		if global, isGlobal := ref.(Global); err == nil && isGlobal && global.IsStatic {
+			namespace = global.Value
+		}
+
+	case ast.FieldAccess:
+		// enums of other packages
+		if iGet, isIdent := lhs.Lhs.(ast.Ident); isIdent {
+			ref, err := vm.cp.reach(iGet.Name)
+			if global, isGlobal := ref.(Global); err == nil && isGlobal && global.IsStatic {
+				if pkg, isPackage := global.asPackage(); isPackage {
+					if symbol, exists := pkg.globals[fields.Get(lhs.Rhs)]; exists && symbol.IsPublic && symbol.IsStatic {
+						namespace = symbol.Value
+					}
+				}
+			}
+		}
+	}
+
+	if namespace == nil {
+		return nil
+	}
+
+	gf, isGoFunc := namespace.AsGoFunc()
+	if !isGoFunc {
+		return nil
+	}
+
+	member, exists := gf.members[fields.Get(fa.Rhs)]
+	if !exists {
+		return nil
+	}
+
+	m, _ := member.asEnum()
+	return m
+}
+
+// checkExhaustive makes sure a switch without a default that only has members of one enum as cases handles all of them
+func (vm *Instance) checkExhaustive(node ast.Switch) {
+	var enum *enumInfo
+	handled := map[*enumMember]bool{}
+	for _, c := range node.Cases {
+		for _, v := range c.Values {
+			m := vm.enumCase(v)
+			if m == nil || (enum != nil && m.enum != enum) {
+				return
+			}
+			enum = m.enum
+			handled[m] = true
+		}
+	}
+
+	if enum == nil {
+		return
+	}
+
+	var missing []string
+	for _, m := range enum.members {
+		if !handled[m] {
+			missing = append(missing, m.String())
+		}
+	}
+
+	if len(missing) != 0 {
+		panic(fmt.Errorf("switch on line %v does not handle %v, add the missing cases or a default", node.Line(), strings.Join(missing, ", ")))
+	}
+}
@@ -9,16 +9,73 @@ import (
 type Exception struct {
 	name    string
 	message string
+	cause   *Exception
 }
 
 func (e Exception) Error() string {
+	if e.cause != nil {
+		return e.name + ": " + e.message + ": " + e.cause.Error()
+	}
 	return e.name + ": " + e.message
 }
 
+// NewError creates an error like the ones made with error(msg) and error.wrap(msg, cause) in evie
+func NewError(message string, cause *Exception) *Exception {
+	return &Exception{name: "Error", message: message, cause: cause}
+}
+
+// Name returns the kind of the exception e.g. TypeError
+func (e *Exception) Name() string {
+	return e.name
+}
+
+// Message returns the message of the exception without its name or cause
+func (e *Exception) Message() string {
+	return e.message
+}
+
+// Cause returns the wrapped exception or nil
+func (e *Exception) Cause() *Exception {
+	return e.cause
+}
+
+// Unwrap makes the cause chain visible to errors.Is and errors.As
+func (e *Exception) Unwrap() error {
+	if e.cause == nil {
+		return nil
+	}
+	return e.cause
+}
+
+// Is reports whether e has the same name as target and, if target has one, the same message
+func (e *Exception) Is(target error) bool {
+	t, ok := target.(*Exception)
+	if !ok {
+		return false
+	}
+	return e.name == t.name && (t.message == "" || e.message == t.message)
+}
+
 var returnSignal = &Exception{name: "signal", message: "return"}
 var continueSignal = &Exception{name: "signal", message: "continue"}
 var breakSignal = &Exception{name: "signal", message: "break"}
 
+// isSignal reports whether e is used for control flow rather than being a real error
+func (e *Exception) isSignal() bool {
+	return e == returnSignal || e == breakSignal || e == continueSignal
+}
+
+// isCancellation reports whether e was raised because a task got cancelled rather than because it failed
+func (e *Exception) isCancellation() bool {
+	return e == ErrCancelled || e == ErrTimeout
+}
+
+// uncatchable reports whether e has to unwind the script past try & catch, which is the case for signals & running out of memory;
+// LimitExceeded can be caught since every further step raises it again anyway
+func (e *Exception) uncatchable() bool {
+	return e.isSignal() || e == ErrOutOfMemory
+}
+
 var notFunction = &Exception{name: "signal", message: "not a function"}
 
 type trace struct {
@@ -42,12 +99,33 @@ var ErrNotCallable error = errors.New("not a callable")
 
 var ErrTypes = &Exception{name: "TypeError", message: "wrong type of arguments given to function"}
 
+// ErrCancelled is raised at the next checkpoint (loop iteration, call or await) of a cancelled task
+var ErrCancelled = &Exception{name: "CancelledError", message: "task was cancelled"}
+
+// ErrTimeout is raised at the next checkpoint once the deadline of the context a script runs under has passed
+var ErrTimeout = &Exception{name: "TimeoutError", message: "deadline exceeded"}
+
+// ErrLimitExceeded is raised once a script has used up the steps allowed by Options.MaxSteps
+var ErrLimitExceeded = &Exception{name: "LimitExceeded", message: "step limit exceeded"}
+
+// ErrOutOfMemory is raised once scripts have allocated more than Options.MaxMemory allows
+var ErrOutOfMemory = &Exception{name: "OutOfMemory", message: "memory limit exceeded"}
+
 func CustomError(msg string, a ...any) *Exception {
-	return &Exception{"RuntimeError", fmt.Sprintf(msg, a...)}
+	return &Exception{name: "RuntimeError", message: fmt.Sprintf(msg, a...)}
 }
 
 func operatorError(op string, a Value, b Value) *Exception {
-	return &Exception{"RuntimeError", fmt.Sprintf("cannot apply '%v' operator on a '%v' and '%v'.", op, a.TypeOf(), b.TypeOf())}
+	// the types are fine for integers but the value of b is not
+	if a.pointer == i64Type && b.pointer == i64Type {
+		switch op {
+		case "/", "%":
+			return &Exception{name: "RuntimeError", message: "integer division by zero."}
+		case "<<", ">>":
+			return &Exception{name: "RuntimeError", message: fmt.Sprintf("cannot shift by a negative amount (%v).", int64(b.scalar))}
+		}
+	}
+	return &Exception{name: "RuntimeError", message: fmt.Sprintf("cannot apply '%v' operator on a '%v' and '%v'.", op, a.TypeOf(), b.TypeOf())}
 }
 
 func TypeError(args []Value, expected ...string) *Exception {
@@ -67,13 +145,21 @@ func TypeError(args []Value, expected ...string) *Exception {
 		}
 	}
 
-	return &Exception{"TypeError", msg + ")"}
+	return &Exception{name: "TypeError", message: msg + ")"}
 }
 
 func RuntimeExceptionF(format string, a ...any) *Exception {
 	return &Exception{name: "RuntimeException", message: fmt.Sprintf(format, a...)}
 }
 
+func indexError(index int, length int) *Exception {
+	return &Exception{name: "IndexError", message: fmt.Sprintf("index %v out of range for length %v", index, length)}
+}
+
+func importError(format string, a ...any) *Exception {
+	return &Exception{name: "ImportError", message: fmt.Sprintf(format, a...)}
+}
+
 func TypeErrorF(format string, a ...any) *Exception {
 	return &Exception{name: "TypeError", message: fmt.Sprintf(format, a...)}
 }
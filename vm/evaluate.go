@@ -15,6 +15,9 @@ func (vm *Instance) evaluate(node ast.Node) any {
 	case ast.Input[bool]:
 		return BoxBool(node.Value)
 
+	case ast.Input[int64]:
+		return BoxInt(node.Value)
+
 	case ast.Input[float64]:
 		return BoxNumber(node.Value)
 
@@ -31,8 +34,8 @@ func (vm *Instance) evaluate(node ast.Node) any {
 		}
 
 		if global, isGlobal := variable.(Global); isGlobal {
-			// global statics evaluate to Value instead of Global
-			if global.IsStatic {
+			// global statics evaluate to Value instead of Global, once they are initialized
+			if global.IsStatic && !vm.cp.pending[global.Value] {
 				return *(global.Value)
 			}
 			return global
@@ -44,12 +47,30 @@ func (vm *Instance) evaluate(node ast.Node) any {
 
 	case ast.FieldAccess:
 		if lhs, ok := vm.evaluate(node.Lhs).(Value); ok {
+			// maps & records are mutable so their fields are not constant
+			_, isMap := lhs.AsMap()
+			if _, isRecord := lhs.AsRecord(); isMap || isRecord {
+				return nil
+			}
+
+			// variable bindings of packages can change so only their reference is constant
+			if pkg, isPackage := lhs.asPackage(); isPackage {
+				if global, exists := pkg.globals[fields.Get(node.Rhs)]; exists && global.IsPublic && !global.IsStatic {
+					return global
+				}
+			}
+
 			if field, exists := lhs.getField(fields.Get(node.Rhs)); exists {
 				//fmt.Println(node, "->", field)
 				return field
 			}
 		}
 
+	case ast.Not:
+		if v, ok := vm.evaluate(node.Value).(Value); ok {
+			return BoxBool(!v.IsTruthy())
+		}
+
 	case ast.BinOp:
 		if lhs, ok := vm.evaluate(node.Lhs).(Value); ok {
 			if rhs, ok := vm.evaluate(node.Rhs).(Value); ok {
@@ -76,6 +97,8 @@ func (vm *Instance) evaluate(node ast.Node) any {
 					}
 				case ast.EqOp:
 					return BoxBool(lhs.Equals(rhs))
+				case ast.NeqOp:
+					return BoxBool(!lhs.Equals(rhs))
 				case ast.LtOp:
 					if res, ok := lhs.LessThan(rhs); ok {
 						return res
@@ -84,6 +107,26 @@ func (vm *Instance) evaluate(node ast.Node) any {
 					if res, ok := lhs.GreaterThan(rhs); ok {
 						return res
 					}
+				case ast.BitAndOp:
+					if res, ok := lhs.BitAnd(rhs); ok {
+						return res
+					}
+				case ast.BitOrOp:
+					if res, ok := lhs.BitOr(rhs); ok {
+						return res
+					}
+				case ast.BitXorOp:
+					if res, ok := lhs.BitXor(rhs); ok {
+						return res
+					}
+				case ast.ShlOp:
+					if res, ok := lhs.Shl(rhs); ok {
+						return res
+					}
+				case ast.ShrOp:
+					if res, ok := lhs.Shr(rhs); ok {
+						return res
+					}
 				}
 			}
 		}
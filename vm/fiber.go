@@ -1,12 +1,23 @@
 package vm
 
+import "slices"
+
 type fiber struct {
-	vm             *Instance // the instance that spawned this fiber
-	unsynchronized bool      // run in unsynchronized mode or not
-	active         *UserFn   // currently active user function
-	stack          []*Value  // flat shared stack for local variables in the current call stack
-	base           int       // where locals of the active function start at
-	boxes          []Value   // pooled boxes for this fiber
+	vm             *Instance        // the instance that spawned this fiber
+	unsynchronized bool             // run in unsynchronized mode or not
+	active         *UserFn          // currently active user function
+	stack          []*Value         // flat shared stack for local variables in the current call stack
+	base           int              // where locals of the active function start at
+	boxes          []Value          // pooled boxes for this fiber
+	scope          *task            // the task or nursery that tasks spawned by this fiber belong to
+	yield          func(Value) bool // hands values to whoever pulls from the generator running on this fiber
+	deferred       []deferral       // calls deferred by the functions on the call stack, the last one runs first
+}
+
+// deferral is a call put off by a defer statement
+type deferral struct {
+	fn   Value
+	args []instruction
 }
 
 func (fbr *fiber) synced() bool {
@@ -17,6 +28,17 @@ func (fbr *fiber) unsynced() bool {
 	return fbr.unsynchronized
 }
 
+// cancelled is the cancellation checkpoint used by loops & calls, it returns the exception to abort with
+func (fbr *fiber) cancelled() *Exception {
+	return fbr.scope.reason.Load()
+}
+
+// uncatchable reports whether exc has to unwind past try & catch, which also goes for the cancellation of the task itself;
+// the cancellation of an awaited task can still be caught
+func (fbr *fiber) uncatchable(exc *Exception) bool {
+	return exc.uncatchable() || (exc.isCancellation() && exc == fbr.cancelled())
+}
+
 func (fbr *fiber) get(binding local) *Value {
 	if !binding.isCaptured {
 		return fbr.stack[fbr.base+int(binding.index)]
@@ -56,6 +78,53 @@ func (fbr *fiber) popStack(n int) {
 	fbr.stack = fbr.stack[:len(fbr.stack)-n]
 }
 
+// frame pushes the locals of fn & assigns args to them, the args that don't fit go into the rest parameter
+func (fbr *fiber) frame(fn *UserFn, args []Value) (base int) {
+	base = len(fbr.stack)
+	for _, escapes := range fn.locals {
+		if !escapes {
+			fbr.stack = append(fbr.stack, fbr.pop())
+		} else {
+			fbr.stack = append(fbr.stack, &Value{})
+		}
+	}
+
+	given := min(len(args), len(fn.args))
+	for idx, arg := range args[:given] {
+		*(fbr.stack[base+idx]) = arg
+	}
+
+	if fn.rest {
+		*(fbr.stack[base+len(fn.args)]) = BoxArray(slices.Clone(args[given:]))
+	}
+	return base
+}
+
+// fill evaluates the default values of the args that were not given, the frame of fn has to be the active one
+func (fbr *fiber) fill(fn *UserFn, given int) *Exception {
+	optional := len(fn.args) - len(fn.defaults)
+	for idx := max(given, optional); idx < len(fn.args); idx++ {
+		value, exc := fn.defaults[idx-optional](fbr)
+		if exc != nil {
+			return exc
+		}
+		fbr.setLocal(idx, value)
+	}
+	return nil
+}
+
+// unwind releases the locals of fn that were set up so far, used when a call is aborted half way
+func (fbr *fiber) unwind(fn *UserFn, base int) {
+	recyclable := 0
+	for _, escapes := range fn.locals[:len(fbr.stack)-base] {
+		if !escapes {
+			recyclable++
+		}
+	}
+	fbr.push(recyclable)
+	fbr.stack = fbr.stack[:base]
+}
+
 func (fbr *fiber) swapBase(base int) (old int) {
 	old = fbr.base
 	fbr.base = base
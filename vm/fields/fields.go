@@ -3,12 +3,19 @@ package fields
 type ID int
 
 var registry = map[string]ID{}
+var names []string
 
 func Get(name string) ID {
 	index, exists := registry[name]
 	if !exists {
 		registry[name] = ID(len(registry))
+		names = append(names, name)
 		return ID(len(registry) - 1)
 	}
 	return index
 }
+
+// Name returns the name that was registered for the given ID
+func Name(id ID) string {
+	return names[id]
+}
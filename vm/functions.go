@@ -1,11 +1,13 @@
 package vm
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"unsafe"
 
 	"github.com/hxkhan/evie/ast"
+	"github.com/hxkhan/evie/vm/fields"
 )
 
 type capture struct {
@@ -22,14 +24,17 @@ func (c capture) String() string {
 
 // funcInfoStatic holds static function information
 type funcInfoStatic struct {
-	name       string       // name of the function
-	args       []string     // argument names
-	locals     []bool       // all locals & true for those that escape
-	captures   []capture    // captured references
-	recyclable int          // number of non-escaping locals
-	code       instruction  // the actual function code
-	mode       ast.SyncMode // the sync mode of the action
-	vm         *Instance    // the corresponding vm
+	name       string        // name of the function
+	args       []string      // argument names
+	defaults   []instruction // default values of the last len(defaults) args, run in the frame of the call
+	rest       bool          // the local after the args collects the extra arguments into an array
+	receiver   bool          // the function is a method & its first arg is the receiver
+	locals     []bool        // all locals & true for those that escape
+	captures   []capture     // captured references
+	recyclable int           // number of non-escaping locals
+	code       instruction   // the actual function code
+	mode       ast.SyncMode  // the sync mode of the action
+	vm         *Instance     // the corresponding vm
 }
 
 type UserFn struct {
@@ -45,12 +50,63 @@ func (fn UserFn) String() string {
 	return "<function>"
 }
 
+// flexible reports whether fn has default or rest parameters, calls to those can't assume a fixed number of arguments
+func (fn *funcInfoStatic) flexible() bool {
+	return len(fn.defaults) != 0 || fn.rest
+}
+
+// checkArity returns an exception if fn can't be called with n arguments
+func (fn *funcInfoStatic) checkArity(n int) *Exception {
+	required := len(fn.args) - len(fn.defaults)
+	if n >= required && (n <= len(fn.args) || fn.rest) {
+		return nil
+	}
+
+	// the receiver of a method is not counted as an argument
+	args := len(fn.args)
+	if fn.receiver {
+		required, args, n = required-1, args-1, n-1
+	}
+
+	expected := fmt.Sprint(required)
+	if fn.rest {
+		expected = fmt.Sprintf("at least %v", required)
+	} else if required != args {
+		expected = fmt.Sprintf("%v to %v", required, args)
+	}
+
+	if fn.receiver {
+		return CustomError("method '%v' requires %v argument(s), %v provided", fn.name, expected, n)
+	}
+	if fn.name != "λ" {
+		return CustomError("function '%v' requires %v argument(s), %v provided", fn.name, expected, n)
+	}
+	return CustomError("function requires %v argument(s), %v provided", expected, n)
+}
+
 func (fn *UserFn) Call(args ...Value) (result Value, err error) {
-	if len(fn.args) != len(args) {
-		if fn.name != "λ" {
-			return Value{}, CustomError("function '%v' requires %v argument(s), %v provided", fn.name, len(fn.args), len(args))
-		}
-		return Value{}, CustomError("function requires %v argument(s), %v provided", len(fn.args), len(args))
+	return fn.call(fn.vm.rt.root, args)
+}
+
+// CallContext is like Call but aborts once ctx is done, in which case ctx.Err() is returned;
+// tasks started by the function inherit ctx
+func (fn *UserFn) CallContext(ctx context.Context, args ...Value) (result Value, err error) {
+	scope, release, err := fn.vm.contextScope(ctx)
+	if err != nil {
+		return Value{}, err
+	}
+	defer release()
+
+	result, err = fn.call(scope, args)
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	return result, err
+}
+
+func (fn *UserFn) call(scope *task, args []Value) (result Value, err error) {
+	if exc := fn.checkArity(len(args)); exc != nil {
+		return Value{}, exc
 	}
 
 	vm := fn.vm
@@ -63,27 +119,21 @@ func (fn *UserFn) Call(args ...Value) (result Value, err error) {
 	fbr.active = fn
 	fbr.base = 0
 	fbr.stack = fbr.stack[:0]
+	fbr.scope = scope
 
 	// create space for all the locals
-	for idx, escapes := range fn.locals {
-		if !escapes {
-			fbr.stack = append(fbr.stack, fbr.pop())
-		} else {
-			fbr.stack = append(fbr.stack, &Value{})
-		}
-
-		// assign arguments
-		if idx < len(args) {
-			*fbr.stack[idx] = args[idx]
-		}
-	}
+	fbr.frame(fn, args)
 
 	// prep for execution & save currently captured values
-	result, exc := fn.code(fbr)
+	exc := fbr.fill(fn, len(args))
+	if exc == nil {
+		result, exc = fn.code(fbr)
+	}
 	//fmt.Println(exc)
 
 	// release non-escaping locals & fiber
 	fbr.push(fn.recyclable)
+	fbr.scope = vm.rt.root
 	vm.rt.fibers.Put(fbr)
 
 	// don't implicitly return the return value of the last executed instruction
@@ -133,7 +183,7 @@ func (fn *UserFn) SaveInto(ptr any) (err error) {
 				v := in[idx]
 				switch v.Kind() {
 				case reflect.Int, reflect.Int32, reflect.Int64:
-					*fbr.stack[idx] = BoxNumber(float64(v.Int()))
+					*fbr.stack[idx] = BoxInt(v.Int())
 				case reflect.Float32, reflect.Float64:
 					*fbr.stack[idx] = BoxNumber(v.Float())
 				case reflect.String:
@@ -159,6 +209,10 @@ func (fn *UserFn) SaveInto(ptr any) (err error) {
 
 		switch resultKind {
 		case reflect.Int:
+			if i, ok := result.AsInt64(); ok {
+				out[0] = reflect.ValueOf(int(i))
+				break
+			}
 			f, ok := result.AsFloat64()
 			if !ok {
 				panic("not ok")
@@ -189,12 +243,30 @@ type Method struct {
 }
 
 func (m Method) call(fbr *fiber, arguments []instruction) (result Value, exc *Exception) {
+	// methods of records get their receiver as the first argument
+	if fn, ok := m.fn.AsUserFn(); ok {
+		if exc := fn.checkArity(len(arguments) + 1); exc != nil {
+			return Value{}, exc
+		}
+		return fbr.vm.callValue(fbr, m.fn, append(constants([]Value{m.this}), arguments...))
+	}
+
 	fn, ok := m.fn.AsGoFunc()
 	if !ok {
 		return Value{}, notFunction
 	}
 
-	if fn.nargs-1 != len(arguments) {
+	// methods may grow their receiver e.g. push or create new values e.g. split
+	if vm := fbr.vm; vm.rt.maxMemory != 0 {
+		before := sizeOf(m.this)
+		defer func() {
+			if exc == nil {
+				exc = vm.charge(sizeOf(m.this) - before + sizeOf(result))
+			}
+		}()
+	}
+
+	if fn.nargs != -1 && fn.nargs-1 != len(arguments) {
 		return Value{}, CustomError("method requires %v argument(s), %v provided", fn.nargs-1, len(arguments))
 	}
 
@@ -219,7 +291,12 @@ func (m Method) call(fbr *fiber, arguments []instruction) (result Value, exc *Ex
 
 	switch fn.nargs {
 	case -1:
-		panic("variadic functions not supported yet")
+		function := *(*func([]Value) (Value, *Exception))(fn.ptr)
+		args, exc := evalArgs(fbr, arguments, m.this)
+		if exc != nil {
+			return Value{}, exc
+		}
+		return function(args)
 	case 0:
 		panic("how did we get a method that does not even take itself as an arguement?")
 	case 1:
@@ -238,9 +315,10 @@ func (m Method) call(fbr *fiber, arguments []instruction) (result Value, exc *Ex
 }
 
 type GoFunc struct {
-	nargs int
-	ptr   unsafe.Pointer
-	mode  ast.SyncMode
+	nargs   int
+	ptr     unsafe.Pointer
+	mode    ast.SyncMode
+	members map[fields.ID]*Value // optional fields e.g. error.wrap
 }
 
 func (fn GoFunc) Synced() bool {
@@ -248,10 +326,19 @@ func (fn GoFunc) Synced() bool {
 }
 
 func (fn *GoFunc) call(fbr *fiber, arguments []instruction) (result Value, exc *Exception) {
-	if fn.nargs != len(arguments) {
+	if fn.nargs != -1 && fn.nargs != len(arguments) {
 		return Value{}, CustomError("function requires %v argument(s), %v provided", fn.nargs, len(arguments))
 	}
 
+	// values returned by Go functions are assumed to be new
+	if vm := fbr.vm; vm.rt.maxMemory != 0 {
+		defer func() {
+			if exc == nil {
+				exc = vm.charge(sizeOf(result))
+			}
+		}()
+	}
+
 	// no sync mode transition needed
 	if fn.mode == ast.AgnosticMode {
 		return fn.invoke(fbr, arguments)
@@ -280,7 +367,12 @@ func (fn *GoFunc) callTransition(fbr *fiber, arguments []instruction) (result Va
 func (fn *GoFunc) invoke(fbr *fiber, arguments []instruction) (result Value, exc *Exception) {
 	switch fn.nargs {
 	case -1:
-		panic("variadic functions not supported yet")
+		function := *(*func([]Value) (Value, *Exception))(fn.ptr)
+		args, exc := evalArgs(fbr, arguments)
+		if exc != nil {
+			return Value{}, exc
+		}
+		return function(args)
 	case 0:
 		function := *(*func() (Value, *Exception))(fn.ptr)
 		return function()
@@ -307,3 +399,52 @@ func (fn *GoFunc) invoke(fbr *fiber, arguments []instruction) (result Value, exc
 
 	panic("unsuported call")
 }
+
+// apply calls fn with arguments that are already evaluated, there have to be as many as it takes
+func (fn *GoFunc) apply(args []Value) (Value, *Exception) {
+	switch fn.nargs {
+	case -1:
+		return (*(*func([]Value) (Value, *Exception))(fn.ptr))(args)
+	case 0:
+		return (*(*func() (Value, *Exception))(fn.ptr))()
+	case 1:
+		return (*(*func(Value) (Value, *Exception))(fn.ptr))(args[0])
+	case 2:
+		return (*(*func(Value, Value) (Value, *Exception))(fn.ptr))(args[0], args[1])
+	case 3:
+		return (*(*func(Value, Value, Value) (Value, *Exception))(fn.ptr))(args[0], args[1], args[2])
+	case 4:
+		return (*(*func(Value, Value, Value, Value) (Value, *Exception))(fn.ptr))(args[0], args[1], args[2], args[3])
+	case 5:
+		return (*(*func(Value, Value, Value, Value, Value) (Value, *Exception))(fn.ptr))(args[0], args[1], args[2], args[3], args[4])
+	case 6:
+		return (*(*func(Value, Value, Value, Value, Value, Value) (Value, *Exception))(fn.ptr))(args[0], args[1], args[2], args[3], args[4], args[5])
+	}
+
+	panic("unsuported call")
+}
+
+// evalArgs evaluates arguments in order after the given leading values
+func evalArgs(fbr *fiber, arguments []instruction, leading ...Value) ([]Value, *Exception) {
+	args := make([]Value, len(leading), len(leading)+len(arguments))
+	copy(args, leading)
+	for _, argument := range arguments {
+		arg, exc := argument(fbr)
+		if exc != nil {
+			return nil, exc
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// constants turns values into instructions, for arguments that are only known once spread at run time
+func constants(values []Value) []instruction {
+	arguments := make([]instruction, len(values))
+	for i, value := range values {
+		arguments[i] = func(fbr *fiber) (Value, *Exception) {
+			return value, nil
+		}
+	}
+	return arguments
+}
@@ -1,12 +1,16 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"iter"
 	"log"
 	"os"
+	goruntime "runtime"
 	"slices"
 	"sync"
+	"sync/atomic"
 
 	"github.com/hxkhan/evie/ast"
 	"github.com/hxkhan/evie/ds"
@@ -25,6 +29,7 @@ type closure struct {
 	freeVars ds.Set[int]
 	scope    ds.Scope
 	info     *funcInfoStatic
+	defers   bool // the function has defer statements
 }
 
 type compiler struct {
@@ -35,15 +40,30 @@ type compiler struct {
 	closures ds.Slice[*closure]     // currently open closures
 	modes    ds.Slice[ast.SyncMode] // sync mode stack
 
-	resolver func(name string) Package
+	resolver Resolver
+	policy   *Policy
+	loading  []string // packages being compiled right now, in import order
+
+	topLevelLogic bool              // allow calls in package level declarations
+	pending       map[*Value]bool   // package level bindings that are not initialized yet
+	refs          ds.Set[fields.ID] // collects the package symbols referred to while set
 }
 
 type runtime struct {
-	packages map[string]*packageInstance // loaded packages
-	fibers   sync.Pool                   // pooled fibers for this vm
-	trace    []string                    // call-stack trace
-	gil      sync.Mutex                  // global interpreter lock
-	wg       sync.WaitGroup              // wait for all fibers to complete
+	packages  map[string]*packageInstance // loaded packages
+	fibers    sync.Pool                   // pooled fibers for this vm
+	trace     []string                    // call-stack trace
+	gil       sync.Mutex                  // global interpreter lock
+	wg        sync.WaitGroup              // wait for all fibers to complete
+	root      *task                       // the scope of tasks spawned outside of any task or nursery
+	steps     atomic.Int64                // loop iterations & function calls executed so far
+	maxSteps  int64                       // raise LimitExceeded once steps goes beyond this, 0 means no limit
+	memory    atomic.Int64                // approximate bytes allocated by scripts so far
+	maxMemory int64                       // raise OutOfMemory once memory goes beyond this, 0 means no limit
+
+	mu          sync.Mutex                           // guards unhandled
+	unhandled   []*unhandled                         // exceptions of failed tasks that may never be awaited
+	onUnhandled func(exc *Exception, trace []string) // reports unhandled exceptions to the host
 }
 
 // Global is just a wrapper for a global variable reference
@@ -54,8 +74,11 @@ type Global struct {
 }
 
 type packageInstance struct {
-	name    string               // name of the package
-	globals map[fields.ID]Global // all global symbols
+	name     string                    // name of the package
+	globals  map[fields.ID]Global      // all global symbols
+	requires map[fields.ID]requirement // capabilities needed to import symbols of host packages
+	blocked  map[fields.ID]string      // symbols withheld by the import policy & why
+	sources  []ast.Package             // files of a user package that have not been compiled yet
 }
 
 // PackageContructor returns a new instance of a host package
@@ -66,23 +89,41 @@ type Options struct {
 	LogCaptures     bool // log when and what is captured
 	DisableInlining bool // use dispatch inlining (combining instructions into one)
 	Metrics         bool // collect metrics (affects performance)
-	TopLevelLogic   bool // whether to only allow declarations at top level
-
-	ImportsResolver  func(name string) Package // to instantiate host packages when user packages import them
-	UniversalStatics map[string]*Value         // implicitly visible to all user packages
+	TopLevelLogic   bool // whether to allow calls in package level declarations, e.g. table := buildTable()
+	MaxSteps        int  // the budget of loop iterations & function calls, 0 means unlimited (counting costs nothing then)
+	MaxMemory       int  // the approximate bytes scripts may allocate for strings, arrays, buffers & maps, 0 means unlimited
+
+	ImportsResolver  Resolver          // to instantiate the packages user packages import, see FileResolver
+	UniversalStatics map[string]*Value // implicitly visible to all user packages
+	ImportPolicy     *Policy           // restricts what can be imported from host packages, nil allows everything
+
+	// receives exceptions of failed tasks that were never awaited, trace lists the task & the tasks that spawned it;
+	// they are reported by WaitForNoActivity and are logged if this is not set. A task that is garbage collected
+	// before that is reported from a goroutine of its own, at any time & possibly after the call that spawned it
+	// returned. The GIL is never held while this runs, so it may call back into the instance but has to be safe
+	// to run concurrently with scripts
+	OnUnhandledException func(exc *Exception, trace []string)
 }
 
 func New(opts Options) (vm *Instance) {
 	vm = &Instance{
 		compiler{
 			resolver: opts.ImportsResolver,
-			statics:  opts.UniversalStatics,
-			inline:   !opts.DisableInlining,
-			modes:    make(ds.Slice[ast.SyncMode], 0, 6),
-			closures: make(ds.Slice[*closure], 0, 6),
+			policy:   opts.ImportPolicy,
+			pending:  map[*Value]bool{},
+
+			topLevelLogic: opts.TopLevelLogic,
+			statics:       opts.UniversalStatics,
+			inline:        !opts.DisableInlining,
+			modes:         make(ds.Slice[ast.SyncMode], 0, 6),
+			closures:      make(ds.Slice[*closure], 0, 6),
 		},
 		runtime{
-			packages: make(map[string]*packageInstance),
+			packages:    make(map[string]*packageInstance),
+			root:        newTask(nil),
+			maxSteps:    int64(opts.MaxSteps),
+			maxMemory:   int64(opts.MaxMemory),
+			onUnhandled: opts.OnUnhandledException,
 		},
 		logger{
 			Logger:      *log.New(os.Stdout, "", 0),
@@ -92,7 +133,7 @@ func New(opts Options) (vm *Instance) {
 
 	vm.rt.fibers = sync.Pool{
 		New: func() any {
-			return &fiber{vm: vm, boxes: make([]Value, 48)}
+			return &fiber{vm: vm, boxes: make([]Value, 48), scope: vm.rt.root}
 		},
 	}
 
@@ -100,11 +141,16 @@ func New(opts Options) (vm *Instance) {
 }
 
 func (vm *Instance) EvalNode(node ast.Node) (result Value, err error) {
+	return vm.evalNode(vm.rt.root, node)
+}
+
+func (vm *Instance) evalNode(scope *task, node ast.Node) (result Value, err error) {
 	vm.rt.AcquireGIL()
 	defer vm.rt.ReleaseGIL()
+	defer vm.recoverCompileError(&err)
 
 	if pkg, isPackage := node.(ast.Package); isPackage {
-		v, exc := vm.runPackage(pkg)
+		v, exc := vm.runPackage(scope, pkg)
 		if exc != nil {
 			err = exc
 		}
@@ -115,12 +161,16 @@ func (vm *Instance) EvalNode(node ast.Node) (result Value, err error) {
 		fbr.active = &UserFn{funcInfoStatic: &funcInfoStatic{name: "anonymous"}}
 		fbr.base = 0
 		fbr.stack = fbr.stack[:0]
+		fbr.scope = scope
 
 		v, exc := vm.compile(node)(fbr)
 		if exc != nil {
 			err = exc
 		}
 		result = v
+
+		fbr.scope = vm.rt.root
+		vm.rt.fibers.Put(fbr)
 	}
 
 	// don't implicitly return the return value of the last executed instruction
@@ -134,6 +184,29 @@ func (vm *Instance) EvalNode(node ast.Node) (result Value, err error) {
 	}
 }
 
+// recoverCompileError returns the errors the compiler raises by panicking as err, so a broken script cannot crash the host;
+// anything else, like a runtime error of Go itself, keeps panicking
+func (vm *Instance) recoverCompileError(err *error) {
+	r := recover()
+	switch r := r.(type) {
+	case nil:
+		return
+	case goruntime.Error:
+		panic(r)
+	case error:
+		*err = r
+	case string:
+		*err = errors.New(r)
+	default:
+		panic(r)
+	}
+
+	// the compilation was abandoned halfway through
+	vm.cp.closures = vm.cp.closures[:0]
+	vm.cp.modes = vm.cp.modes[:0]
+	vm.cp.refs = nil
+}
+
 func (vm *Instance) EvalScript(input []byte) (Value, error) {
 	output, err := parser.Parse(input)
 	if err != nil {
@@ -143,6 +216,26 @@ func (vm *Instance) EvalScript(input []byte) (Value, error) {
 	return vm.EvalNode(output)
 }
 
+// EvalScriptContext is like EvalScript but aborts once ctx is done, in which case ctx.Err() is returned
+func (vm *Instance) EvalScriptContext(ctx context.Context, input []byte) (Value, error) {
+	output, err := parser.Parse(input)
+	if err != nil {
+		return Value{}, err
+	}
+
+	scope, release, err := vm.contextScope(ctx)
+	if err != nil {
+		return Value{}, err
+	}
+	defer release()
+
+	result, err := vm.evalNode(scope, output)
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	return result, err
+}
+
 // Packages iterates through loaded packages
 func (vm *Instance) Packages() iter.Seq[Package] {
 	return func(yield func(Package) bool) {
@@ -163,6 +256,19 @@ func (vm *Instance) GetPackage(name string) (pkg Package) {
 	return pkg
 }
 
+// Import loads a package through Options.ImportsResolver, the same way an imports(...) header would
+func (vm *Instance) Import(name string) (pkg Package, err error) {
+	vm.rt.AcquireGIL()
+	defer vm.rt.ReleaseGIL()
+	defer vm.recoverCompileError(&err)
+
+	instance, exc := vm.importPackage(vm.rt.root, name)
+	if exc != nil {
+		return nil, exc
+	}
+	return instance, nil
+}
+
 func (pkg *packageInstance) SetSymbol(name string, value Value) (overridden bool) {
 	index := fields.Get(name)
 	ref, exists := pkg.globals[index]
@@ -180,13 +286,46 @@ func (pkg *packageInstance) GetSymbol(name string) (value Global, exists bool) {
 	return v, exists
 }
 
+func (pkg *packageInstance) Require(name string, capability string, paths ...int) {
+	if pkg.requires == nil {
+		pkg.requires = map[fields.ID]requirement{}
+	}
+	pkg.requires[fields.Get(name)] = requirement{capability, paths}
+}
+
+func (pkg *packageInstance) Exports() (names []string) {
+	for index, global := range pkg.globals {
+		if global.IsPublic {
+			names = append(names, fields.Name(index))
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
 func (pkg *packageInstance) HasSymbol(name string) (exists bool) {
 	_, exists = pkg.globals[fields.Get(name)]
 	return exists
 }
 
+func (pkg *packageInstance) instance() *packageInstance {
+	return pkg
+}
+
+// Steps returns how many loop iterations & function calls have been executed, only counted when Options.MaxSteps is set
+func (vm *Instance) Steps() int {
+	return int(vm.rt.steps.Load())
+}
+
+// ResetSteps starts counting steps from zero again, giving scripts a fresh budget
+func (vm *Instance) ResetSteps() {
+	vm.rt.steps.Store(0)
+}
+
+// WaitForNoActivity waits for all tasks to finish and then reports the exceptions of those that were never awaited
 func (vm *Instance) WaitForNoActivity() {
 	vm.rt.wg.Wait()
+	vm.reportUnhandled()
 }
 
 type local struct {
@@ -213,6 +352,9 @@ func (cp *compiler) reach(name string) (v any, err error) {
 
 	// 2. check package globals
 	if ref, exists := cp.pkg.globals[fields.Get(name)]; exists {
+		if cp.refs != nil {
+			cp.refs.Add(fields.Get(name))
+		}
 		return ref, nil
 	}
 
@@ -0,0 +1,204 @@
+package vm
+
+import (
+	"iter"
+	goruntime "runtime"
+
+	"github.com/hxkhan/evie/ast"
+)
+
+// Generator is what calling a function that yields gives back; its body runs on a fiber of its own,
+// which is suspended at every yield until the next value is pulled by a for loop, .next() or the host
+type Generator struct {
+	fn     *UserFn
+	params []Value // arguments of the call, in the order of the locals they go into
+	scope  *task   // tasks spawned by the body belong to the scope of the call
+	co     *coroutine
+}
+
+// coroutine is the running part of a generator, kept apart so an abandoned generator can be collected & stopped
+type coroutine struct {
+	vm   *Instance
+	fbr  *fiber
+	next func() (Value, bool)
+	stop func()
+	exc  *Exception // what the body raised, reported once it is done
+
+	running bool
+	done    bool
+	cleanup goruntime.Cleanup
+}
+
+// generate turns body into the code of a function that yields, calling it only captures the arguments
+func (vm *Instance) generate(info *funcInfoStatic, body instruction) instruction {
+	params := len(info.args)
+	if info.rest {
+		params++
+	}
+
+	return func(fbr *fiber) (Value, *Exception) {
+		gen := &Generator{fn: fbr.active, params: make([]Value, params), scope: fbr.scope, co: &coroutine{vm: vm}}
+		for i := range gen.params {
+			gen.params[i] = fbr.getLocal(int16(i))
+		}
+		gen.co.body(gen, body)
+		return BoxGenerator(gen), returnSignal
+	}
+}
+
+// body prepares the fiber of gen, the code only starts running once the first value is pulled
+func (co *coroutine) body(gen *Generator, code instruction) {
+	fn := gen.fn
+	seq := func(yield func(Value) bool) {
+		fbr := co.fbr
+		fbr.yield = yield
+
+		_, exc := code(fbr)
+		if exc != returnSignal {
+			co.exc = exc
+		}
+
+		// release non-escaping locals & fiber
+		fbr.push(fn.recyclable)
+		fbr.popStack(len(fn.locals))
+		fbr.yield = nil
+		fbr.scope = co.vm.rt.root
+		co.vm.rt.fibers.Put(fbr)
+		co.fbr = nil
+	}
+
+	co.fbr = co.vm.rt.fibers.Get().(*fiber)
+	co.fbr.active = fn
+	co.fbr.base = 0
+	co.fbr.stack = co.fbr.stack[:0]
+	co.fbr.scope = gen.scope
+	co.fbr.frame(fn, nil)
+	for i, param := range gen.params {
+		co.fbr.setLocal(i, param)
+	}
+
+	co.next, co.stop = iter.Pull(seq)
+
+	// a generator that is dropped half way is stopped so its body can unwind
+	co.cleanup = goruntime.AddCleanup(gen, func(co *coroutine) {
+		go co.close()
+	}, co)
+}
+
+// close stops a generator that is not done yet
+func (co *coroutine) close() {
+	co.vm.rt.AcquireGIL()
+	defer co.vm.rt.ReleaseGIL()
+
+	if !co.done {
+		co.done = true
+		co.cleanup.Stop()
+		if co.fbr != nil {
+			co.fbr.unsynchronized = false
+		}
+		co.stop()
+	}
+}
+
+// resume runs gen until its next yield, unsynced tells whether whoever pulls the value holds the GIL;
+// the body runs while the puller waits, so it borrows its hold of the GIL
+func (gen *Generator) resume(unsynced bool) (value Value, ok bool, exc *Exception) {
+	co := gen.co
+	if co.done {
+		return Value{}, false, nil
+	}
+	if co.running {
+		return Value{}, false, CustomError("generator '%v' cannot resume itself", gen.fn.name)
+	}
+
+	co.running = true
+	defer func() { co.running = false }()
+
+	gen.switchTo(unsynced, func() {
+		value, ok = co.next()
+	})
+
+	if !ok {
+		co.done = true
+		co.cleanup.Stop()
+		exc, co.exc = co.exc, nil
+	}
+	return value, ok, exc
+}
+
+// stop ends gen early from a fiber, unsynced tells whether the caller holds the GIL like it does for resume;
+// the body unwinds right away so its deferred calls have run once stop returns, exc is what they raised
+func (gen *Generator) stop(unsynced bool) (exc *Exception) {
+	co := gen.co
+	if co.done || co.running {
+		return nil
+	}
+
+	co.done = true
+	co.cleanup.Stop()
+	co.running = true
+	defer func() { co.running = false }()
+
+	gen.switchTo(unsynced, co.stop)
+	exc, co.exc = co.exc, nil
+	return exc
+}
+
+// switchTo runs step, which hands control over to the fiber of gen, with the GIL held the way the fiber expects it
+func (gen *Generator) switchTo(unsynced bool, step func()) {
+	co := gen.co
+	synced := gen.fn.Synced()
+	switch {
+	// no transition
+	case !unsynced == synced || gen.fn.mode == ast.AgnosticMode:
+		co.fbr.unsynchronized = unsynced
+		step()
+
+	// to synced
+	case synced:
+		co.vm.rt.AcquireGIL()
+		co.fbr.unsynchronized = false
+		step()
+		co.vm.rt.ReleaseGIL()
+
+	// to unsynced
+	default:
+		co.vm.rt.ReleaseGIL()
+		co.fbr.unsynchronized = true
+		step()
+		co.vm.rt.AcquireGIL()
+	}
+}
+
+// Next resumes gen until it yields its next value, ok is false once it is done & err is what the body raised
+func (gen *Generator) Next() (value Value, ok bool, err error) {
+	gen.fn.vm.rt.AcquireGIL()
+	defer gen.fn.vm.rt.ReleaseGIL()
+
+	value, ok, exc := gen.resume(false)
+	if exc != nil {
+		return value, ok, exc
+	}
+	return value, ok, nil
+}
+
+// Stop ends gen early, it yields nothing afterwards
+func (gen *Generator) Stop() {
+	gen.co.close()
+}
+
+func (vm *Instance) emitYield(node ast.Yield) instruction {
+	value := vm.compile(node.Value)
+	return func(fbr *fiber) (Value, *Exception) {
+		v, exc := value(fbr)
+		if exc != nil {
+			return v, exc
+		}
+
+		// the generator was stopped, unwind as if it returned
+		if !fbr.yield(v) {
+			return Value{}, returnSignal
+		}
+		return Value{}, nil
+	}
+}
@@ -0,0 +1,151 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hxkhan/evie/ast"
+	"github.com/hxkhan/evie/parser"
+	"github.com/hxkhan/evie/vm/fields"
+)
+
+// Resolver instantiates the package a user package imports by name;
+// it should return an error wrapping ErrPackageNotFound for names it does not know
+type Resolver func(name string) (Package, error)
+
+// ErrPackageNotFound tells Resolvers to try the next resolver
+var ErrPackageNotFound = errors.New("package not found")
+
+// Resolvers tries each resolver in order until one knows the package
+func Resolvers(resolvers ...Resolver) Resolver {
+	return func(name string) (Package, error) {
+		err := ErrPackageNotFound
+		for _, resolver := range resolvers {
+			var pkg Package
+			if pkg, err = resolver(name); !errors.Is(err, ErrPackageNotFound) {
+				return pkg, err
+			}
+		}
+		// the last resolver has the final say on why
+		return nil, err
+	}
+}
+
+// FileResolver finds user packages as name.ev or name/*.ev under roots, the first root that has one wins
+func FileResolver(roots ...string) Resolver {
+	return func(name string) (Package, error) {
+		for _, root := range roots {
+			var files []string
+			if single := filepath.Join(root, name+".ev"); isFile(single) {
+				files = []string{single}
+			} else if dir := filepath.Join(root, name); isDir(dir) {
+				files, _ = filepath.Glob(filepath.Join(dir, "*.ev"))
+				if len(files) == 0 {
+					continue
+				}
+			} else {
+				continue
+			}
+
+			pkg := &packageInstance{name: name, globals: map[fields.ID]Global{}}
+			for _, file := range files {
+				input, err := os.ReadFile(file)
+				if err != nil {
+					return nil, err
+				}
+
+				node, err := parser.Parse(input)
+				if err != nil {
+					return nil, fmt.Errorf("%v: %w", file, err)
+				}
+
+				source, isPackage := node.(ast.Package)
+				if !isPackage || source.Name != name {
+					return nil, fmt.Errorf("%v: expected 'package %v'", file, name)
+				}
+				pkg.sources = append(pkg.sources, source)
+			}
+			return pkg, nil
+		}
+		return nil, fmt.Errorf("%w: no %v.ev or %v/*.ev under %v", ErrPackageNotFound, name, name, strings.Join(roots, ", "))
+	}
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// importPackage returns the package called name, loading & compiling it first if it is new
+func (vm *Instance) importPackage(scope *task, name string) (*packageInstance, *Exception) {
+	// a package that is still being loaded imports itself somewhere down the line
+	if i := slices.Index(vm.cp.loading, name); i != -1 {
+		cycle := append(slices.Clone(vm.cp.loading[i:]), name)
+		return nil, importError("import cycle %v", strings.Join(cycle, " -> "))
+	}
+
+	if pkg := vm.rt.packages[name]; pkg != nil {
+		return pkg, nil
+	}
+
+	if vm.cp.resolver == nil {
+		return nil, importError("cannot import '%v' without an imports resolver", name)
+	}
+
+	resolved, err := vm.cp.resolver(name)
+	if err != nil {
+		return nil, importError("cannot import '%v': %v", name, err)
+	}
+	var pkg *packageInstance
+	if resolved != nil {
+		pkg = resolved.instance()
+	}
+	if pkg == nil {
+		return nil, importError("cannot import '%v': the resolver returned no package", name)
+	}
+
+	// host packages are ready to use
+	if pkg.sources == nil {
+		// only keep what the import policy allows
+		if vm.cp.policy != nil {
+			view, err := vm.cp.policy.apply(name, pkg)
+			if err != nil {
+				return nil, importError("%v", err)
+			}
+			pkg = view
+		}
+
+		// save as loaded package
+		vm.rt.packages[name] = pkg
+		return pkg, nil
+	}
+
+	// user packages have to be compiled first
+	outer := vm.cp.pkg
+	defer func() { vm.cp.pkg = outer }()
+
+	// a package that fails to load, also by a compile error, is forgotten so it can be imported again
+	loaded := false
+	vm.rt.packages[name] = pkg
+	defer func() {
+		if !loaded {
+			delete(vm.rt.packages, name)
+		}
+	}()
+
+	if _, exc := vm.runPackage(scope, pkg.sources...); exc != nil {
+		return nil, exc
+	}
+	pkg.sources = nil
+	loaded = true
+	return pkg, nil
+}
@@ -0,0 +1,109 @@
+package vm
+
+import (
+	"iter"
+	"slices"
+	"strings"
+	"unsafe"
+)
+
+// Map is a string keyed container that remembers the order its keys were inserted in
+type Map struct {
+	keys    []string
+	entries map[string]Value
+}
+
+// NewMap creates an empty map with room for n entries
+func NewMap(n int) *Map {
+	return &Map{keys: make([]string, 0, n), entries: make(map[string]Value, n)}
+}
+
+// Get looks up the value stored under key
+func (m *Map) Get(key string) (v Value, exists bool) {
+	v, exists = m.entries[key]
+	return v, exists
+}
+
+// Set stores v under key, new keys are placed after all existing ones
+func (m *Map) Set(key string, v Value) {
+	if _, exists := m.entries[key]; !exists {
+		m.keys = append(m.keys, key)
+	}
+	m.entries[key] = v
+}
+
+// Delete removes key from the map
+func (m *Map) Delete(key string) (existed bool) {
+	if _, existed = m.entries[key]; existed {
+		delete(m.entries, key)
+		m.keys = slices.DeleteFunc(m.keys, func(k string) bool { return k == key })
+	}
+	return existed
+}
+
+// Len returns the number of entries
+func (m *Map) Len() int {
+	return len(m.keys)
+}
+
+// All iterates through the entries in insertion order
+func (m *Map) All() iter.Seq2[string, Value] {
+	return func(yield func(string, Value) bool) {
+		for _, key := range m.keys {
+			if !yield(key, m.entries[key]) {
+				return
+			}
+		}
+	}
+}
+
+func (m *Map) String() string {
+	return m.format(nil)
+}
+
+func (m *Map) format(seen []unsafe.Pointer) string {
+	if slices.Contains(seen, unsafe.Pointer(m)) {
+		return "{...}"
+	}
+	seen = append(seen, unsafe.Pointer(m))
+
+	builder := strings.Builder{}
+	builder.WriteByte('{')
+
+	for i, key := range m.keys {
+		if isName(key) {
+			builder.WriteString(key)
+		} else {
+			builder.WriteByte('"')
+			builder.WriteString(key)
+			builder.WriteByte('"')
+		}
+		builder.WriteString(": ")
+
+		writeElement(&builder, m.entries[key], seen)
+
+		if i != len(m.keys)-1 {
+			builder.WriteString(", ")
+		}
+	}
+
+	builder.WriteByte('}')
+	return builder.String()
+}
+
+// isName reports whether key could be written as a bare name in a map literal
+func isName(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	for i, r := range key {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
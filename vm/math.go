@@ -1,9 +1,22 @@
 package vm
 
-import "math"
+import (
+	"math"
+
+	"github.com/hxkhan/evie/ast"
+)
+
+/*
+	Integer arithmetic wraps around on overflow & division truncates towards zero, just like in Go.
+	The methods below only apply to two numbers of the same kind, which keeps them small enough to be inlined;
+	an integer mixed with a float is promoted to a float by the slow path in mixed.
+	Bitwise operators only apply to integers.
+*/
 
 func (x Value) Add(y Value) (z Value, ok bool) {
-	if x.pointer == f64Type && y.pointer == f64Type {
+	if x.pointer == i64Type && y.pointer == i64Type {
+		return BoxInt(int64(x.scalar) + int64(y.scalar)), true
+	} else if x.pointer == f64Type && y.pointer == f64Type {
 		return BoxNumber(math.Float64frombits(x.scalar) + math.Float64frombits(y.scalar)), true
 	} else if x, ok := x.AsString(); ok {
 		if y, ok := y.AsString(); ok {
@@ -14,59 +27,217 @@ func (x Value) Add(y Value) (z Value, ok bool) {
 }
 
 func (x Value) Sub(y Value) (z Value, ok bool) {
-	if x.pointer == f64Type && y.pointer == f64Type {
+	if x.pointer == i64Type && y.pointer == i64Type {
+		return BoxInt(int64(x.scalar) - int64(y.scalar)), true
+	} else if x.pointer == f64Type && y.pointer == f64Type {
 		return BoxNumber(math.Float64frombits(x.scalar) - math.Float64frombits(y.scalar)), true
 	}
 	return Value{}, false
 }
 
 func (x Value) Mul(y Value) (z Value, ok bool) {
-	if x.pointer == f64Type && y.pointer == f64Type {
+	if x.pointer == i64Type && y.pointer == i64Type {
+		return BoxInt(int64(x.scalar) * int64(y.scalar)), true
+	} else if x.pointer == f64Type && y.pointer == f64Type {
 		return BoxNumber(math.Float64frombits(x.scalar) * math.Float64frombits(y.scalar)), true
 	}
 	return Value{}, false
 }
 
 func (x Value) Div(y Value) (z Value, ok bool) {
-	if x.pointer == f64Type && y.pointer == f64Type {
+	if x.pointer == i64Type && y.pointer == i64Type {
+		if y.scalar == 0 {
+			return Value{}, false
+		}
+		return BoxInt(int64(x.scalar) / int64(y.scalar)), true
+	} else if x.pointer == f64Type && y.pointer == f64Type {
 		return BoxNumber(math.Float64frombits(x.scalar) / math.Float64frombits(y.scalar)), true
 	}
 	return Value{}, false
 }
 
 func (x Value) Mod(y Value) (z Value, ok bool) {
-	if x.pointer == f64Type && y.pointer == f64Type {
-		x := math.Float64frombits(x.scalar)
-		y := math.Float64frombits(y.scalar)
-		return BoxNumber(math.Mod(x, y)), true
+	if x.pointer == i64Type && y.pointer == i64Type {
+		if y.scalar == 0 {
+			return Value{}, false
+		}
+		return BoxInt(int64(x.scalar) % int64(y.scalar)), true
+	} else if x.pointer == f64Type && y.pointer == f64Type {
+		return BoxNumber(math.Mod(math.Float64frombits(x.scalar), math.Float64frombits(y.scalar))), true
 	}
 	return Value{}, false
 }
 
+// the comparisons fold their float case into the return, z is meaningless unless ok, to stay within the inlining budget
 func (x Value) LessThan(y Value) (z Value, ok bool) {
-	if x.pointer == f64Type && y.pointer == f64Type {
-		return BoxBool(math.Float64frombits(x.scalar) < math.Float64frombits(y.scalar)), true
+	if x.pointer == i64Type && y.pointer == i64Type {
+		return BoxBool(int64(x.scalar) < int64(y.scalar)), true
 	}
-	return Value{}, false
+	return BoxBool(math.Float64frombits(x.scalar) < math.Float64frombits(y.scalar)), x.pointer == f64Type && y.pointer == f64Type
 }
 
 func (x Value) GreaterThan(y Value) (z Value, ok bool) {
-	if x.pointer == f64Type && y.pointer == f64Type {
-		return BoxBool(math.Float64frombits(x.scalar) > math.Float64frombits(y.scalar)), true
+	if x.pointer == i64Type && y.pointer == i64Type {
+		return BoxBool(int64(x.scalar) > int64(y.scalar)), true
 	}
-	return Value{}, false
+	return BoxBool(math.Float64frombits(x.scalar) > math.Float64frombits(y.scalar)), x.pointer == f64Type && y.pointer == f64Type
 }
 
 func (x Value) LessThanOrEqualTo(y Value) (z Value, ok bool) {
-	if x.pointer == f64Type && y.pointer == f64Type {
-		return BoxBool(math.Float64frombits(x.scalar) <= math.Float64frombits(y.scalar)), true
+	if x.pointer == i64Type && y.pointer == i64Type {
+		return BoxBool(int64(x.scalar) <= int64(y.scalar)), true
 	}
-	return Value{}, false
+	return BoxBool(math.Float64frombits(x.scalar) <= math.Float64frombits(y.scalar)), x.pointer == f64Type && y.pointer == f64Type
 }
 
 func (x Value) GreaterThanOrEqualTo(y Value) (z Value, ok bool) {
-	if x.pointer == f64Type && y.pointer == f64Type {
-		return BoxBool(math.Float64frombits(x.scalar) >= math.Float64frombits(y.scalar)), true
+	if x.pointer == i64Type && y.pointer == i64Type {
+		return BoxBool(int64(x.scalar) >= int64(y.scalar)), true
+	}
+	return BoxBool(math.Float64frombits(x.scalar) >= math.Float64frombits(y.scalar)), x.pointer == f64Type && y.pointer == f64Type
+}
+
+func (x Value) BitAnd(y Value) (z Value, ok bool) {
+	if x.pointer == i64Type && y.pointer == i64Type {
+		return BoxInt(int64(x.scalar & y.scalar)), true
+	}
+	return Value{}, false
+}
+
+func (x Value) BitOr(y Value) (z Value, ok bool) {
+	if x.pointer == i64Type && y.pointer == i64Type {
+		return BoxInt(int64(x.scalar | y.scalar)), true
+	}
+	return Value{}, false
+}
+
+func (x Value) BitXor(y Value) (z Value, ok bool) {
+	if x.pointer == i64Type && y.pointer == i64Type {
+		return BoxInt(int64(x.scalar ^ y.scalar)), true
 	}
 	return Value{}, false
 }
+
+// Shl shifts x to the left by y bits, shifting by 64 or more gives 0
+func (x Value) Shl(y Value) (z Value, ok bool) {
+	if x.pointer == i64Type && y.pointer == i64Type && int64(y.scalar) >= 0 {
+		return BoxInt(int64(x.scalar) << y.scalar), true
+	}
+	return Value{}, false
+}
+
+// Shr shifts x to the right by y bits keeping its sign, shifting by 64 or more gives 0 or -1
+func (x Value) Shr(y Value) (z Value, ok bool) {
+	if x.pointer == i64Type && y.pointer == i64Type && int64(y.scalar) >= 0 {
+		return BoxInt(int64(x.scalar) >> y.scalar), true
+	}
+	return Value{}, false
+}
+
+// mixed is the slow path of the arithmetic & comparison operators, an integer & a float are promoted to floats;
+// anything else the fast paths turned down is an operator error
+func mixed(op string, x, y Value) (Value, *Exception) {
+	var a, b float64
+	switch {
+	case x.pointer == i64Type && y.pointer == f64Type:
+		a, b = float64(int64(x.scalar)), math.Float64frombits(y.scalar)
+	case x.pointer == f64Type && y.pointer == i64Type:
+		a, b = math.Float64frombits(x.scalar), float64(int64(y.scalar))
+	default:
+		return Value{}, operatorError(op, x, y)
+	}
+
+	switch op {
+	case "+":
+		return BoxNumber(a + b), nil
+	case "-":
+		return BoxNumber(a - b), nil
+	case "*":
+		return BoxNumber(a * b), nil
+	case "/":
+		return BoxNumber(a / b), nil
+	case "%":
+		return BoxNumber(math.Mod(a, b)), nil
+	case "<":
+		return BoxBool(a < b), nil
+	case ">":
+		return BoxBool(a > b), nil
+	case "<=":
+		return BoxBool(a <= b), nil
+	case ">=":
+		return BoxBool(a >= b), nil
+	}
+	return Value{}, operatorError(op, x, y)
+}
+
+// mixedInto is mixed for compound assignments like x += 0.5, the result is stored in lhs
+func mixedInto(op string, lhs *Value, rhs Value) *Exception {
+	result, exc := mixed(op, *lhs, rhs)
+	if exc != nil {
+		return exc
+	}
+	*lhs = result
+	return nil
+}
+
+// operate applies the arithmetic or bitwise operator op to x & y, it backs compound assignments without a fast path
+func operate(op ast.Operator, x, y Value) (Value, *Exception) {
+	var result Value
+	var ok bool
+	switch op {
+	case ast.AddOp:
+		result, ok = x.Add(y)
+	case ast.SubOp:
+		result, ok = x.Sub(y)
+	case ast.MulOp:
+		result, ok = x.Mul(y)
+	case ast.DivOp:
+		result, ok = x.Div(y)
+	case ast.ModOp:
+		result, ok = x.Mod(y)
+	case ast.BitAndOp:
+		result, ok = x.BitAnd(y)
+	case ast.BitOrOp:
+		result, ok = x.BitOr(y)
+	case ast.BitXorOp:
+		result, ok = x.BitXor(y)
+	case ast.ShlOp:
+		result, ok = x.Shl(y)
+	case ast.ShrOp:
+		result, ok = x.Shr(y)
+	}
+
+	if ok {
+		return result, nil
+	}
+	return mixed(op.String(), x, y)
+}
+
+// numEquals compares the number x to y exactly, an integer only equals a float if the float holds the same whole number
+func (x Value) numEquals(y Value) bool {
+	switch {
+	case x.pointer == i64Type && y.pointer == i64Type:
+		return x.scalar == y.scalar
+	case x.pointer == f64Type && y.pointer == f64Type:
+		return math.Float64frombits(x.scalar) == math.Float64frombits(y.scalar)
+	case x.pointer == i64Type && y.pointer == f64Type:
+		return wholeEquals(math.Float64frombits(y.scalar), int64(x.scalar))
+	case x.pointer == f64Type && y.pointer == i64Type:
+		return wholeEquals(math.Float64frombits(x.scalar), int64(y.scalar))
+	}
+	return false
+}
+
+// wholeEquals reports whether f holds exactly the whole number i
+func wholeEquals(f float64, i int64) bool {
+	i2, isWhole := wholeInt(f)
+	return isWhole && i2 == i
+}
+
+// wholeInt converts f to an int64 if it is a whole number within the range of int64
+func wholeInt(f float64) (i int64, ok bool) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
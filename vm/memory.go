@@ -0,0 +1,84 @@
+package vm
+
+import "unsafe"
+
+// rough sizes used for memory accounting
+const (
+	valueSize  = int(unsafe.Sizeof(Value{}))
+	headerSize = 24                       // slice & string headers plus the box around them
+	entrySize  = valueSize + 2*headerSize // one map entry; key, value & its slot in the key order
+)
+
+// sizeOf approximates the bytes v occupies on its own, not counting the values it refers to
+func sizeOf(v Value) int {
+	if isKnown(v.pointer) {
+		return 0
+	}
+
+	switch v.scalar {
+	case stringType:
+		return headerSize + len(*(*string)(v.pointer))
+	case arrayType:
+		return headerSize + cap(*(*[]Value)(v.pointer))*valueSize
+	case bufferType:
+		return headerSize + cap(*(*[]byte)(v.pointer))
+	case mapType:
+		return headerSize + (*Map)(v.pointer).Len()*entrySize
+	case recordType:
+		return headerSize + len((*Record)(v.pointer).values)*valueSize
+	}
+	return 0
+}
+
+// charge accounts for bytes freshly allocated by a script; going over Options.MaxMemory raises OutOfMemory
+func (vm *Instance) charge(bytes int) *Exception {
+	if bytes <= 0 {
+		return nil
+	}
+
+	if vm.rt.memory.Add(int64(bytes)) > vm.rt.maxMemory {
+		return ErrOutOfMemory
+	}
+	return nil
+}
+
+// allocates makes code pay for the value it produces; without a limit code is returned as is
+func (vm *Instance) allocates(code instruction) instruction {
+	if vm.rt.maxMemory == 0 {
+		return code
+	}
+
+	return func(fbr *fiber) (Value, *Exception) {
+		v, exc := code(fbr)
+		if exc != nil {
+			return v, exc
+		}
+		return v, vm.charge(sizeOf(v))
+	}
+}
+
+// chargeEntry pays for a new entry when key is about to be added to the map m
+func (vm *Instance) chargeEntry(m Value, key Value) *Exception {
+	if vm.rt.maxMemory == 0 {
+		return nil
+	}
+
+	if m, ok := m.AsMap(); ok {
+		if key, ok := key.AsString(); ok {
+			if _, exists := m.Get(key); !exists {
+				return vm.charge(entrySize)
+			}
+		}
+	}
+	return nil
+}
+
+// Memory returns the approximate bytes allocated by scripts, only counted when Options.MaxMemory is set
+func (vm *Instance) Memory() int {
+	return int(vm.rt.memory.Load())
+}
+
+// ResetMemory starts counting allocations from zero again, giving scripts a fresh allowance
+func (vm *Instance) ResetMemory() {
+	vm.rt.memory.Store(0)
+}
@@ -42,4 +42,118 @@ var arrayMethods = map[fields.ID]*Value{
 		}
 		return Value{}, ErrTypes
 	}).Allocate(),
+	fields.Get("push"): BoxGoFunc(func(this, v Value) (Value, *Exception) {
+		if _, ok := this.AsArray(); ok {
+			// arrays share their header so appending is visible to every reference
+			array := (*[]Value)(this.pointer)
+			*array = append(*array, v)
+			return Value{}, nil
+		}
+		return Value{}, ErrTypes
+	}).Allocate(),
+	fields.Get("len"): BoxGoFunc(func(this Value) (Value, *Exception) {
+		if array, ok := this.AsArray(); ok {
+			return BoxInt(int64(len(array))), nil
+		}
+		return Value{}, ErrTypes
+	}).Allocate(),
+}
+
+var mapMethods = map[fields.ID]*Value{
+	fields.Get("len"): BoxGoFunc(func(this Value) (Value, *Exception) {
+		if m, ok := this.AsMap(); ok {
+			return BoxInt(int64(m.Len())), nil
+		}
+		return Value{}, ErrTypes
+	}).Allocate(),
+	fields.Get("keys"): BoxGoFunc(func(this Value) (Value, *Exception) {
+		if m, ok := this.AsMap(); ok {
+			keys := make([]Value, 0, m.Len())
+			for key := range m.All() {
+				keys = append(keys, BoxString(key))
+			}
+			return BoxArray(keys), nil
+		}
+		return Value{}, ErrTypes
+	}).Allocate(),
+	fields.Get("has"): BoxGoFunc(func(this, key Value) (Value, *Exception) {
+		if m, ok := this.AsMap(); ok {
+			if key, ok := key.AsString(); ok {
+				_, exists := m.Get(key)
+				return BoxBool(exists), nil
+			}
+		}
+		return Value{}, ErrTypes
+	}).Allocate(),
+	fields.Get("delete"): BoxGoFunc(func(this, key Value) (Value, *Exception) {
+		if m, ok := this.AsMap(); ok {
+			if key, ok := key.AsString(); ok {
+				return BoxBool(m.Delete(key)), nil
+			}
+		}
+		return Value{}, ErrTypes
+	}).Allocate(),
+}
+
+var errorMethods = map[fields.ID]*Value{
+	fields.Get("message"): BoxGoFunc(func(this Value) (Value, *Exception) {
+		if exc, ok := this.AsError(); ok {
+			return BoxString(exc.message), nil
+		}
+		return Value{}, ErrTypes
+	}).Allocate(),
+	fields.Get("name"): BoxGoFunc(func(this Value) (Value, *Exception) {
+		if exc, ok := this.AsError(); ok {
+			return BoxString(exc.name), nil
+		}
+		return Value{}, ErrTypes
+	}).Allocate(),
+	fields.Get("cause"): BoxGoFunc(func(this Value) (Value, *Exception) {
+		if exc, ok := this.AsError(); ok {
+			if exc.cause == nil {
+				return Value{}, nil
+			}
+			return BoxError(exc.cause), nil
+		}
+		return Value{}, ErrTypes
+	}).Allocate(),
+}
+
+var taskMethods = map[fields.ID]*Value{
+	fields.Get("cancel"): BoxGoFunc(func(this Value) (Value, *Exception) {
+		if t, ok := this.AsTask(); ok {
+			t.cancel(ErrCancelled)
+			return Value{}, nil
+		}
+		return Value{}, ErrTypes
+	}).Allocate(),
+	fields.Get("cancelled"): BoxGoFunc(func(this Value) (Value, *Exception) {
+		if t, ok := this.AsTask(); ok {
+			return BoxBool(t.reason.Load() != nil), nil
+		}
+		return Value{}, ErrTypes
+	}).Allocate(),
+}
+
+var generatorMethods = map[fields.ID]*Value{
+	// value, ok := gen.next()
+	fields.Get("next"): BoxGoFuncSynced(func(this Value) (Value, *Exception) {
+		if gen, ok := this.AsGenerator(); ok {
+			value, ok, exc := gen.resume(false)
+			if exc != nil {
+				return Value{}, exc
+			}
+			return BoxArray([]Value{value, BoxBool(ok)}), nil
+		}
+		return Value{}, ErrTypes
+	}).Allocate(),
+}
+
+var enumMethods = map[fields.ID]*Value{
+	fields.Get("name"): BoxGoFunc(func(this Value) (Value, *Exception) {
+		if m, ok := this.asEnum(); ok {
+			return BoxString(m.name), nil
+		}
+		return Value{}, ErrTypes
+	}).Allocate(),
 }
@@ -0,0 +1,128 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ManifestName is the file that turns a directory into a module
+const ManifestName = "evie.mod"
+
+// Module is a directory of packages described by its evie.mod manifest, which looks like
+//
+//	module shop
+//	sources src lib
+//	require ../common
+//
+// sources defaults to the directory of the manifest and require lists the directories of local modules it depends on
+type Module struct {
+	Name     string    // name of the module
+	Dir      string    // absolute directory of the manifest
+	Sources  []string  // absolute directories packages are looked up in
+	Requires []*Module // local modules this one depends on
+}
+
+// LoadModule reads the manifest in dir along with the manifests of the modules it requires
+func LoadModule(dir string) (*Module, error) {
+	return loadModule(dir, map[string]*Module{}, nil)
+}
+
+func loadModule(dir string, loaded map[string]*Module, chain []string) (*Module, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, other := range chain {
+		if other == dir {
+			return nil, fmt.Errorf("module cycle %v", strings.Join(append(chain[i:], dir), " -> "))
+		}
+	}
+
+	// modules required by several others are only loaded once
+	if mod, exists := loaded[dir]; exists {
+		return mod, nil
+	}
+
+	path := filepath.Join(dir, ManifestName)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mod := &Module{Dir: dir}
+	var requires []string
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "//")
+		words := strings.Fields(text)
+		if len(words) == 0 {
+			continue
+		}
+
+		switch words[0] {
+		case "module":
+			if len(words) != 2 || mod.Name != "" {
+				return nil, fmt.Errorf("%v:%v: expected a single 'module <name>'", path, line)
+			}
+			mod.Name = words[1]
+		case "sources":
+			for _, source := range words[1:] {
+				mod.Sources = append(mod.Sources, filepath.Join(dir, source))
+			}
+		case "require":
+			for _, require := range words[1:] {
+				requires = append(requires, filepath.Join(dir, require))
+			}
+		default:
+			return nil, fmt.Errorf("%v:%v: unknown directive '%v'", path, line, words[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if mod.Name == "" {
+		return nil, fmt.Errorf("%v: missing 'module <name>'", path)
+	}
+	if len(mod.Sources) == 0 {
+		mod.Sources = []string{dir}
+	}
+
+	loaded[dir] = mod
+	for _, require := range requires {
+		dep, err := loadModule(require, loaded, append(chain, dir))
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", mod.Name, err)
+		}
+		mod.Requires = append(mod.Requires, dep)
+	}
+	return mod, nil
+}
+
+// Resolver finds packages in the sources of the module first and then in those of the modules it requires
+func (mod *Module) Resolver() Resolver {
+	var roots []string
+	seen := map[*Module]bool{}
+
+	var walk func(mod *Module)
+	walk = func(mod *Module) {
+		if seen[mod] {
+			return
+		}
+		seen[mod] = true
+
+		roots = append(roots, mod.Sources...)
+		for _, dep := range mod.Requires {
+			walk(dep)
+		}
+	}
+	walk(mod)
+
+	return FileResolver(roots...)
+}
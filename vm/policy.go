@@ -0,0 +1,188 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unsafe"
+
+	"github.com/hxkhan/evie/vm/fields"
+)
+
+// Policy restricts what scripts can import from host packages
+type Policy struct {
+	Allow        []string // packages e.g. "fs" or symbols e.g. "fs.readFile" that may be imported; empty allows everything
+	Deny         []string // packages or symbols that may never be imported, takes precedence over Allow
+	Capabilities []string // granted capabilities e.g. "time:sleep" or "fs:read under /data"
+}
+
+// grant is a parsed capability, roots limits the paths it applies to
+type grant struct {
+	name  string
+	roots []string
+}
+
+// requirement is the capability a symbol of a host package needs, paths are the indexes of its arguments that name files
+type requirement struct {
+	capability string
+	paths      []int
+}
+
+func (p *Policy) grants() (map[string]*grant, error) {
+	grants := map[string]*grant{}
+	unrestricted := map[string]bool{}
+
+	for _, token := range p.Capabilities {
+		parts := strings.Fields(token)
+		if len(parts) != 1 && (len(parts) != 3 || parts[1] != "under") {
+			return nil, fmt.Errorf("invalid capability %q, expected 'name' or 'name under path'", token)
+		}
+
+		g := grants[parts[0]]
+		if g == nil {
+			g = &grant{name: parts[0]}
+			grants[parts[0]] = g
+		}
+
+		if len(parts) == 1 {
+			unrestricted[g.name] = true
+			continue
+		}
+
+		root, err := resolvePath(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid capability %q: %v", token, err)
+		}
+		g.roots = append(g.roots, root)
+	}
+
+	// a grant without a path covers every path
+	for name := range unrestricted {
+		grants[name].roots = nil
+	}
+	return grants, nil
+}
+
+func (p *Policy) lists(list []string, pkg string, symbol string) bool {
+	return slices.Contains(list, pkg) || slices.Contains(list, pkg+"."+symbol)
+}
+
+// apply returns the view of pkg that scripts are allowed to see, the policy refers to it by the name it is imported as
+func (p *Policy) apply(name string, pkg *packageInstance) (*packageInstance, error) {
+	if slices.Contains(p.Deny, name) {
+		return nil, fmt.Errorf("import of package '%v' is denied by the import policy", name)
+	}
+
+	allowed := len(p.Allow) == 0 || slices.ContainsFunc(p.Allow, func(entry string) bool {
+		return entry == name || strings.HasPrefix(entry, name+".")
+	})
+	if !allowed {
+		return nil, fmt.Errorf("import of package '%v' is not allowed by the import policy", name)
+	}
+
+	grants, err := p.grants()
+	if err != nil {
+		return nil, err
+	}
+
+	view := &packageInstance{name: pkg.name, globals: map[fields.ID]Global{}, blocked: map[fields.ID]string{}}
+	for id, global := range pkg.globals {
+		symbol := fields.Name(id)
+
+		switch {
+		case p.lists(p.Deny, name, symbol):
+			view.blocked[id] = "it is denied"
+		case len(p.Allow) != 0 && !p.lists(p.Allow, name, symbol):
+			view.blocked[id] = "it is not in the allow list"
+		case pkg.requires[id].capability != "":
+			req := pkg.requires[id]
+			g, granted := grants[req.capability]
+			if !granted {
+				view.blocked[id] = fmt.Sprintf("it requires the capability '%v'", req.capability)
+				continue
+			}
+
+			// restrict the paths it can be used on
+			if len(g.roots) != 0 && len(req.paths) != 0 {
+				guarded := guardPath(*global.Value, g, req.paths)
+				global.Value = &guarded
+			}
+			view.globals[id] = global
+		default:
+			view.globals[id] = global
+		}
+	}
+	return view, nil
+}
+
+// resolvePath makes path absolute & follows its symlinks so it can be compared against roots;
+// the part of path that does not exist yet e.g. a file about to be created is kept as is
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	var missing []string
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) || dir == filepath.Dir(dir) {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(dir)}, missing...)
+	}
+}
+
+// guardPath wraps a Go function so the arguments at paths have to be inside of the roots of g
+func guardPath(v Value, g *grant, paths []int) Value {
+	fn, ok := v.AsGoFunc()
+	if !ok {
+		return v
+	}
+
+	check := func(path Value) *Exception {
+		str, ok := path.AsString()
+		if !ok {
+			return ErrTypes
+		}
+
+		abs, err := resolvePath(str)
+		if err != nil {
+			return &Exception{name: "PermissionError", message: err.Error()}
+		}
+
+		for _, root := range g.roots {
+			if rel, err := filepath.Rel(root, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return nil
+			}
+		}
+		return &Exception{name: "PermissionError", message: fmt.Sprintf("capability '%v' does not cover '%v'", g.name, str)}
+	}
+
+	// the guard takes the arguments as a slice so functions of any arity can be wrapped the same way
+	outer := func(args []Value) (Value, *Exception) {
+		if fn.nargs != -1 && fn.nargs != len(args) {
+			return Value{}, CustomError("function requires %v argument(s), %v provided", fn.nargs, len(args))
+		}
+
+		for _, index := range paths {
+			if index < len(args) {
+				if exc := check(args[index]); exc != nil {
+					return Value{}, exc
+				}
+			}
+		}
+		return fn.apply(args)
+	}
+
+	guarded := *fn
+	guarded.nargs = -1
+	guarded.ptr = unsafe.Pointer(&outer)
+	return Value{scalar: goFuncType, pointer: unsafe.Pointer(&guarded)}
+}
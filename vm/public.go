@@ -9,9 +9,14 @@ func NewHostPackage(name string) Package {
 	}
 }
 
+// Package is a loaded package or one created with NewHostPackage; the interface is sealed so methods can be added to it
 type Package interface {
 	SetSymbol(name string, value Value) (overridden bool) // sets a global symbol
 	HasSymbol(name string) (exists bool)                  // checks if a symbol exists
 	GetSymbol(name string) (sym Global, exists bool)      // does a symbol lookup
 	Box() (value Value)                                   // boxes an evie package to be used as a value
+	Require(name string, capability string, paths ...int) // only lets scripts import a symbol when capability is granted
+	Exports() (names []string)                            // lists the public symbols in sorted order
+
+	instance() *packageInstance
 }
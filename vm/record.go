@@ -0,0 +1,173 @@
+package vm
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unsafe"
+
+	"github.com/hxkhan/evie/ast"
+	"github.com/hxkhan/evie/vm/fields"
+)
+
+// typeInfo describes a record type, all records of the type share it
+type typeInfo struct {
+	name    string
+	names   []string             // field names in the order they were declared
+	index   map[fields.ID]int    // position of each field
+	methods map[fields.ID]*Value // functions declared with the type as receiver
+}
+
+// Record is a value of a type declared by a script e.g. Point(1, 2)
+type Record struct {
+	typ    *typeInfo
+	values []Value
+}
+
+func newTypeInfo(node ast.Type) *typeInfo {
+	typ := &typeInfo{
+		name:    node.Name,
+		names:   node.Fields,
+		index:   make(map[fields.ID]int, len(node.Fields)),
+		methods: map[fields.ID]*Value{},
+	}
+	for i, name := range node.Fields {
+		typ.index[fields.Get(name)] = i
+	}
+	return typ
+}
+
+// constructor returns the function that creates records of typ, its members are the methods of typ
+func (typ *typeInfo) constructor() Value {
+	ctor := BoxGoFunc(func(args []Value) (Value, *Exception) {
+		// Point() leaves every field nil
+		if len(args) == 0 {
+			args = make([]Value, len(typ.names))
+		}
+
+		if len(args) != len(typ.names) {
+			return Value{}, CustomError("type '%v' has %v field(s), %v value(s) provided", typ.name, len(typ.names), len(args))
+		}
+		return BoxRecord(&Record{typ: typ, values: args}), nil
+	})
+
+	gf, _ := ctor.AsGoFunc()
+	gf.members = typ.methods
+	return ctor
+}
+
+// addMethod attaches the method fn to typ, methods can't share a name with each other or with a field
+func (typ *typeInfo) addMethod(node ast.Fn, fn Value) {
+	index := fields.Get(node.Name)
+	if _, exists := typ.index[index]; exists {
+		panic(fmt.Errorf("method '%v' on line %v has the same name as a field of type '%v'", node.Name, node.Line(), typ.name))
+	}
+	if _, exists := typ.methods[index]; exists {
+		panic(fmt.Errorf("double declaration of %v.%v", typ.name, node.Name))
+	}
+	typ.methods[index] = &fn
+}
+
+// TypeName returns the name of the type of r
+func (r *Record) TypeName() string {
+	return r.typ.name
+}
+
+// Get returns the field called name
+func (r *Record) Get(name string) (value Value, exists bool) {
+	i, exists := r.typ.index[fields.Get(name)]
+	if !exists {
+		return Value{}, false
+	}
+	return r.values[i], true
+}
+
+// Set changes the field called name, records can't gain new fields
+func (r *Record) Set(name string, value Value) (exists bool) {
+	i, exists := r.typ.index[fields.Get(name)]
+	if exists {
+		r.values[i] = value
+	}
+	return exists
+}
+
+// equals reports whether r & other are of the same type & have equal fields
+func (r *Record) equals(other *Record) bool {
+	return r.equalsIn(other, nil)
+}
+
+// equalsIn is equals, seen holds the pairs being compared further up; a pair that is met again is
+// taken to be equal so records that refer back to themselves are compared without going around forever
+func (r *Record) equalsIn(other *Record, seen [][2]*Record) bool {
+	if r == other {
+		return true
+	}
+	if r.typ != other.typ {
+		return false
+	}
+
+	pair := [2]*Record{r, other}
+	if slices.Contains(seen, pair) {
+		return true
+	}
+	seen = append(seen, pair)
+
+	for i, value := range r.values {
+		if x, ok := value.AsRecord(); ok {
+			if y, ok := other.values[i].AsRecord(); ok {
+				if !x.equalsIn(y, seen) {
+					return false
+				}
+				continue
+			}
+		}
+
+		if !value.Equals(other.values[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Record) String() string {
+	return r.format(nil)
+}
+
+func (r *Record) format(seen []unsafe.Pointer) string {
+	if slices.Contains(seen, unsafe.Pointer(r)) {
+		return r.typ.name + "{...}"
+	}
+	seen = append(seen, unsafe.Pointer(r))
+
+	builder := strings.Builder{}
+	builder.WriteString(r.typ.name)
+	builder.WriteByte('{')
+
+	for i, name := range r.typ.names {
+		builder.WriteString(name)
+		builder.WriteString(": ")
+
+		writeElement(&builder, r.values[i], seen)
+
+		if i != len(r.typ.names)-1 {
+			builder.WriteString(", ")
+		}
+	}
+
+	builder.WriteByte('}')
+	return builder.String()
+}
+
+// emitType declares a record type inside of a function, its methods can only be declared on the package level
+func (vm *Instance) emitType(node ast.Type) instruction {
+	index, ok := vm.cp.closures.Last(0).scope.Declare(node.Name, true)
+	if !ok {
+		panic(fmt.Errorf("double declaration of %s", node.Name))
+	}
+
+	ctor := newTypeInfo(node).constructor()
+	return func(fbr *fiber) (Value, *Exception) {
+		fbr.setLocal(index, ctor)
+		return Value{}, nil
+	}
+}
@@ -1,16 +1,307 @@
 package vm
 
-func NewTask(fn func() (Value, *Exception)) Value {
-	task := make(chan evaluation, 1)
-	go func() {
-		res, err := fn()
-		task <- evaluation{res, err}
-		close(task)
-	}()
-	return BoxTask(task)
+import (
+	"context"
+	"errors"
+	"reflect"
+	goruntime "runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// task is the handle of a `go` call; it is also the cancellation scope of everything that call spawns
+type task struct {
+	name    string                    // name of the function the task runs, used in traces
+	done    chan evaluation           // receives the outcome once and is then closed; nil for nurseries
+	reason  atomic.Pointer[Exception] // polled at checkpoints, set once the task is cancelled
+	stopped chan struct{}             // closed once the task is cancelled, interrupts blocking waits
+	report  atomic.Pointer[unhandled] // the pending report of the exception of a failed task, dropped once it is awaited
+
+	parent   *task
+	nursery  bool               // a failing child cancels every other child
+	mu       sync.Mutex         // guards children & failure
+	children map[*task]struct{} // children that are still running
+	failure  *Exception         // first error raised by a child, only set for nurseries
+	running  sync.WaitGroup     // children that are still running
 }
 
 type evaluation struct {
 	result Value
 	err    *Exception
 }
+
+// newTask creates a task as a child of parent, parent may be nil
+func newTask(parent *task) *task {
+	t := &task{
+		done:     make(chan evaluation, 1),
+		stopped:  make(chan struct{}),
+		parent:   parent,
+		children: map[*task]struct{}{},
+	}
+
+	if parent != nil {
+		parent.mu.Lock()
+		parent.children[t] = struct{}{}
+		parent.running.Add(1)
+		parent.mu.Unlock()
+
+		// children of cancelled tasks are born cancelled
+		if reason := parent.reason.Load(); reason != nil {
+			t.cancel(reason)
+		}
+	}
+	return t
+}
+
+// newNursery creates a scope that waits for its children and cancels them all once one fails
+func newNursery(parent *task) *task {
+	t := newTask(parent)
+	t.done = nil
+	t.nursery = true
+	return t
+}
+
+// finish publishes the outcome of t and lets its parent know
+func (t *task) finish(result Value, exc *Exception) {
+	if t.done != nil {
+		t.done <- evaluation{result, exc}
+		close(t.done)
+	}
+
+	parent := t.parent
+	if parent == nil {
+		return
+	}
+
+	parent.mu.Lock()
+	delete(parent.children, t)
+	failed := parent.nursery && exc != nil && !exc.isCancellation() && parent.failure == nil
+	if failed {
+		parent.failure = exc
+	}
+	parent.mu.Unlock()
+
+	if failed {
+		parent.cancel(ErrCancelled)
+	}
+	parent.running.Done()
+}
+
+// fail records exc as the reason the nursery t failed, unless a child got there first
+func (t *task) fail(exc *Exception) {
+	t.mu.Lock()
+	if t.failure == nil {
+		t.failure = exc
+	}
+	t.mu.Unlock()
+	t.cancel(ErrCancelled)
+}
+
+// cancel stops t and all of its children at their next checkpoint, where they raise reason
+func (t *task) cancel(reason *Exception) {
+	if !t.reason.CompareAndSwap(nil, reason) {
+		return
+	}
+	close(t.stopped)
+
+	t.mu.Lock()
+	children := make([]*task, 0, len(t.children))
+	for child := range t.children {
+		children = append(children, child)
+	}
+	t.mu.Unlock()
+
+	for _, child := range children {
+		child.cancel(reason)
+	}
+}
+
+// trace lists the names of t and the tasks it was spawned from, innermost first
+func (t *task) trace() (names []string) {
+	for ; t != nil; t = t.parent {
+		// nurseries & contexts are nameless
+		if t.name != "" {
+			names = append(names, t.name)
+		}
+	}
+	return names
+}
+
+// contextScope creates a scope that gets cancelled once ctx is done, tasks spawned inside of it inherit ctx;
+// release has to be called once the call made under ctx returns, ctx lets go of the scope once its tasks are done
+func (vm *Instance) contextScope(ctx context.Context) (scope *task, release func(), err error) {
+	if ctx.Err() != nil {
+		return nil, nil, ctx.Err()
+	}
+
+	scope = newTask(vm.rt.root)
+	scope.done = nil
+	stop := context.AfterFunc(ctx, func() {
+		scope.cancel(reasonOf(ctx))
+	})
+
+	done := func() {
+		stop()
+		scope.finish(Value{}, nil)
+	}
+
+	release = func() {
+		scope.mu.Lock()
+		idle := len(scope.children) == 0
+		scope.mu.Unlock()
+
+		if idle {
+			done()
+			return
+		}
+
+		// tasks started by the call still run under ctx, so it has to be able to cancel them until they are done
+		go func() {
+			scope.running.Wait()
+			done()
+		}()
+	}
+	return scope, release, nil
+}
+
+// reasonOf picks the exception a script raises once ctx is done
+func reasonOf(ctx context.Context) *Exception {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	return ErrCancelled
+}
+
+// NewTask runs fn in the background and returns the task to await it with
+func NewTask(fn func() (Value, *Exception)) Value {
+	t := newTask(nil)
+	go func() {
+		t.finish(fn())
+	}()
+	return BoxTask(t)
+}
+
+// awaitAny waits for the first of tasks to finish and returns its index, or -1 if none
+// had finished and block is false; the other tasks are left untouched so they can still be awaited
+func (vm *Instance) awaitAny(fbr *fiber, tasks []*task, block bool) (int, evaluation, *Exception) {
+	cases := make([]reflect.SelectCase, len(tasks), len(tasks)+2)
+	for i, task := range tasks {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(task.done)}
+	}
+
+	// awaiting is a cancellation checkpoint
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(fbr.scope.stopped)})
+
+	if !block {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+	} else if fbr.synced() {
+		// release GIL if synced
+		vm.rt.ReleaseGIL()
+		defer vm.rt.AcquireGIL()
+	}
+
+	chosen, response, ok := reflect.Select(cases)
+	switch {
+	case chosen == len(tasks):
+		return -1, evaluation{}, fbr.cancelled()
+	case chosen > len(tasks):
+		return -1, evaluation{}, nil
+	case !ok:
+		return chosen, evaluation{}, CustomError("cannot await on a finished task")
+	}
+
+	vm.handled(tasks[chosen])
+	return chosen, response.Interface().(evaluation), nil
+}
+
+// await waits for t to finish while staying responsive to cancellation; the GIL is managed by the caller
+func (fbr *fiber) await(t *task) (evaluation, *Exception) {
+	select {
+	case response, ok := <-t.done:
+		if !ok {
+			return evaluation{}, CustomError("cannot await on a finished task")
+		}
+		fbr.vm.handled(t)
+		return response, nil
+	case <-fbr.scope.stopped:
+		return evaluation{}, fbr.cancelled()
+	}
+}
+
+// settle finishes t, keeping its exception around in case it is never awaited; nurseries handle the errors of their children
+func (vm *Instance) settle(t *task, result Value, exc *Exception) {
+	if exc != nil && !exc.isCancellation() && !t.parent.nursery {
+		vm.failed(t, exc)
+	}
+	t.finish(result, exc)
+}
+
+// unhandled is the exception of a task that may never be awaited
+type unhandled struct {
+	exc   *Exception
+	trace []string
+}
+
+// failed remembers the exception of t so it can be reported if nobody awaits t; it is reported by WaitForNoActivity
+// or once t becomes unreachable, whichever comes first
+func (vm *Instance) failed(t *task, exc *Exception) {
+	failure := &unhandled{exc, t.trace()}
+	t.report.Store(failure)
+
+	vm.rt.mu.Lock()
+	vm.rt.unhandled = append(vm.rt.unhandled, failure)
+	vm.rt.mu.Unlock()
+
+	// the report runs on a goroutine of its own so a slow handler does not hold up other cleanups
+	goruntime.AddCleanup(t, func(failure *unhandled) {
+		go vm.report(failure)
+	}, failure)
+}
+
+// handled drops the pending report of t, its outcome has been awaited
+func (vm *Instance) handled(t *task) {
+	if failure := t.report.Swap(nil); failure != nil {
+		vm.rt.mu.Lock()
+		vm.forget(failure)
+		vm.rt.mu.Unlock()
+	}
+}
+
+// forget removes failure from the pending reports and tells whether it was still pending, vm.rt.mu has to be held
+func (vm *Instance) forget(failure *unhandled) (pending bool) {
+	i := slices.Index(vm.rt.unhandled, failure)
+	if i == -1 {
+		return false
+	}
+	vm.rt.unhandled = slices.Delete(vm.rt.unhandled, i, i+1)
+	return true
+}
+
+// report hands failure over to the host unless it was already reported or handled
+func (vm *Instance) report(failure *unhandled) {
+	vm.rt.mu.Lock()
+	pending := vm.forget(failure)
+	vm.rt.mu.Unlock()
+
+	if !pending {
+		return
+	}
+
+	if vm.rt.onUnhandled != nil {
+		vm.rt.onUnhandled(failure.exc, failure.trace)
+		return
+	}
+	vm.log.printf("%v", trace{failure.exc, failure.trace})
+}
+
+// reportUnhandled hands the exceptions of failed tasks that were not awaited over to the host
+func (vm *Instance) reportUnhandled() {
+	vm.rt.mu.Lock()
+	failures := slices.Clone(vm.rt.unhandled)
+	vm.rt.mu.Unlock()
+
+	for _, failure := range failures {
+		vm.report(failure)
+	}
+}
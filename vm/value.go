@@ -2,8 +2,10 @@ package vm
 
 import (
 	"fmt"
+	"iter"
 	"math"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"unsafe"
@@ -24,14 +26,20 @@ So how do we know what it is? We follow some basic rules.
 RULES:
 	1.  nil:     the pointer has to be equal to nil; the scalar is irrelevant
 	2.  bool:    the pointer has to be equal to boolType; the scalar is 0 for false else true
-	3.  float64: the pointer has to be equal to f64Type; the scalar then stores the value
-	4.  string:  the pointer has to be none of (f64Type, boolType); the scalar has to be stringType
-	5.  userFn:  the pointer has to be none of (f64Type, boolType); the scalar has to be userFnType
-	6.  func:    the pointer has to be none of (f64Type, boolType); the scalar has to be funcType
-	7.  array:   the pointer has to be none of (f64Type, boolType); the scalar has to be arrayType
-	8.  task:    the pointer has to be none of (f64Type, boolType); the scalar has to be taskType
-	9.  buffer:  the pointer has to be none of (f64Type, boolType); the scalar has to be bufferType
-	10. custom:  the pointer has to be none of (f64Type, boolType); the scalar has to be customType
+	3.  int64:   the pointer has to be equal to i64Type; the scalar then stores the value
+	4.  float64: the pointer has to be equal to f64Type; the scalar then stores the value
+	5.  string:  the pointer has to be none of (i64Type, f64Type, boolType); the scalar has to be stringType
+	6.  userFn:  the pointer has to be none of (i64Type, f64Type, boolType); the scalar has to be userFnType
+	7.  func:    the pointer has to be none of (i64Type, f64Type, boolType); the scalar has to be funcType
+	8.  array:   the pointer has to be none of (i64Type, f64Type, boolType); the scalar has to be arrayType
+	9.  task:    the pointer has to be none of (i64Type, f64Type, boolType); the scalar has to be taskType
+	10. buffer:  the pointer has to be none of (i64Type, f64Type, boolType); the scalar has to be bufferType
+	11. custom:  the pointer has to be none of (i64Type, f64Type, boolType); the scalar has to be customType
+	12. map:     the pointer has to be none of (i64Type, f64Type, boolType); the scalar has to be mapType
+	13. error:   the pointer has to be none of (i64Type, f64Type, boolType); the scalar has to be errorType
+	14. gen:     the pointer has to be none of (i64Type, f64Type, boolType); the scalar has to be generatorType
+	15. record:  the pointer has to be none of (i64Type, f64Type, boolType); the scalar has to be recordType
+	16. enum:    the pointer has to be none of (i64Type, f64Type, boolType); the scalar has to be enumType
 
 Another alternative to these two is using this exact same Value struct with different rules.
 The scalar would use nan-tagging and would either be a valid float64 or a NaN and contain meta data that
@@ -56,15 +64,22 @@ const (
 	packageType
 	bufferType
 	customType
+	mapType
+	errorType
+	generatorType
+	recordType
+	enumType
 )
 
 // scalar types
+var i64Type = unsafe.Pointer(new(byte))
 var f64Type = unsafe.Pointer(new(byte))
 var boolType = unsafe.Pointer(new(byte))
 
 // scalar types
 var strTypeID = unsafe.Pointer(new(byte))
 var arrayTypeID = unsafe.Pointer(new(byte))
+var mapTypeID = unsafe.Pointer(new(byte))
 
 // CustomValue is an interface for evie hosts to add their own custom values to the language
 type CustomValue interface {
@@ -74,6 +89,12 @@ type CustomValue interface {
 	Equals(b CustomValue) bool
 }
 
+// Iterable can be implemented by custom values so they can be used in for loops
+type Iterable interface {
+	CustomValue
+	Iterate() iter.Seq2[Value, Value] // yields (key, value) pairs
+}
+
 // SafeGoFunc is a compile time safety interface so uncallable functions don't get into the system
 type SafeGoFunc interface {
 	func() (Value, *Exception) |
@@ -82,7 +103,21 @@ type SafeGoFunc interface {
 		func(Value, Value, Value) (Value, *Exception) |
 		func(Value, Value, Value, Value) (Value, *Exception) |
 		func(Value, Value, Value, Value, Value) (Value, *Exception) |
-		func(Value, Value, Value, Value, Value, Value) (Value, *Exception)
+		func(Value, Value, Value, Value, Value, Value) (Value, *Exception) |
+		func([]Value) (Value, *Exception)
+}
+
+// arity returns how many arguments a SafeGoFunc takes, -1 if it takes any number of them as a slice
+func arity(fn any) int {
+	if _, variadic := fn.(func([]Value) (Value, *Exception)); variadic {
+		return -1
+	}
+	return reflect.TypeOf(fn).NumIn()
+}
+
+// BoxInt boxes an int64
+func BoxInt(i int64) Value {
+	return Value{scalar: uint64(i), pointer: i64Type}
 }
 
 // BoxNumber boxes a float64
@@ -111,7 +146,7 @@ func BoxUserFn(fn UserFn) Value {
 // BoxGoFunc boxes a sync-agnostic Go function
 func BoxGoFunc[T SafeGoFunc](fn T) Value {
 	ptr := unsafe.Pointer(&GoFunc{
-		nargs: reflect.TypeOf(fn).NumIn(),
+		nargs: arity(fn),
 		ptr:   unsafe.Pointer(&fn),
 		mode:  ast.AgnosticMode,
 	})
@@ -121,7 +156,7 @@ func BoxGoFunc[T SafeGoFunc](fn T) Value {
 // BoxGoFunc boxes a synced Go function always assuming the safety of the GIL
 func BoxGoFuncSynced[T SafeGoFunc](fn T) Value {
 	ptr := unsafe.Pointer(&GoFunc{
-		nargs: reflect.TypeOf(fn).NumIn(),
+		nargs: arity(fn),
 		ptr:   unsafe.Pointer(&fn),
 		mode:  ast.SyncedMode,
 	})
@@ -131,7 +166,7 @@ func BoxGoFuncSynced[T SafeGoFunc](fn T) Value {
 // BoxGoFunc boxes an unsynced Go function that yields on all calls
 func BoxGoFuncUnsynced[T SafeGoFunc](fn T) Value {
 	ptr := unsafe.Pointer(&GoFunc{
-		nargs: reflect.TypeOf(fn).NumIn(),
+		nargs: arity(fn),
 		ptr:   unsafe.Pointer(&fn),
 		mode:  ast.UnsyncedMode,
 	})
@@ -144,8 +179,22 @@ func BoxArray(array []Value) Value {
 }
 
 // BoxTask boxes an evie task
-func BoxTask(task chan evaluation) Value {
-	return Value{scalar: taskType, pointer: unsafe.Pointer(&task)}
+func BoxTask(t *task) Value {
+	return Value{scalar: taskType, pointer: unsafe.Pointer(t)}
+}
+
+// BoxGenerator boxes an evie generator
+func BoxGenerator(gen *Generator) Value {
+	return Value{scalar: generatorType, pointer: unsafe.Pointer(gen)}
+}
+
+// BoxRecord boxes a value of a type declared by a script
+func BoxRecord(r *Record) Value {
+	return Value{scalar: recordType, pointer: unsafe.Pointer(r)}
+}
+
+func boxEnum(m *enumMember) Value {
+	return Value{scalar: enumType, pointer: unsafe.Pointer(m)}
 }
 
 // BoxPackage boxes an evie package
@@ -167,6 +216,16 @@ func BoxBuffer(bytes []byte) Value {
 	return Value{scalar: bufferType, pointer: unsafe.Pointer(&bytes)}
 }
 
+// BoxMap boxes an evie map
+func BoxMap(m *Map) Value {
+	return Value{scalar: mapType, pointer: unsafe.Pointer(m)}
+}
+
+// BoxError boxes an exception so it can be handled as a value
+func BoxError(exc *Exception) Value {
+	return Value{scalar: errorType, pointer: unsafe.Pointer(exc)}
+}
+
 // BoxCustom boxes a value of a custom type
 func BoxCustom(cv CustomValue) Value {
 	return Value{scalar: customType, pointer: unsafe.Pointer(&cv)}
@@ -176,7 +235,15 @@ func (x Value) IsNil() bool {
 	return x.pointer == nil
 }
 
+func (x Value) AsInt64() (i int64, ok bool) {
+	return int64(x.scalar), x.pointer == i64Type
+}
+
+// AsFloat64 also accepts integers, converting them to the nearest float64
 func (x Value) AsFloat64() (f float64, ok bool) {
+	if x.pointer == i64Type {
+		return float64(int64(x.scalar)), true
+	}
 	return math.Float64frombits(x.scalar), x.pointer == f64Type
 }
 
@@ -217,11 +284,32 @@ func (x Value) AsArray() (array []Value, ok bool) {
 	return *(*[]Value)(x.pointer), true
 }
 
-func (x Value) AsTask() (task <-chan evaluation, ok bool) {
+func (x Value) AsTask() (t *task, ok bool) {
 	if x.scalar != taskType || isKnown(x.pointer) {
 		return nil, false
 	}
-	return *(*chan evaluation)(x.pointer), true
+	return (*task)(x.pointer), true
+}
+
+func (x Value) AsGenerator() (gen *Generator, ok bool) {
+	if x.scalar != generatorType || isKnown(x.pointer) {
+		return nil, false
+	}
+	return (*Generator)(x.pointer), true
+}
+
+func (x Value) AsRecord() (r *Record, ok bool) {
+	if x.scalar != recordType || isKnown(x.pointer) {
+		return nil, false
+	}
+	return (*Record)(x.pointer), true
+}
+
+func (x Value) asEnum() (m *enumMember, ok bool) {
+	if x.scalar != enumType || isKnown(x.pointer) {
+		return nil, false
+	}
+	return (*enumMember)(x.pointer), true
 }
 
 func (x Value) asPackage() (pkg *packageInstance, ok bool) {
@@ -252,6 +340,20 @@ func (x Value) AsBuffer() (buffer []byte, ok bool) {
 	return *(*[]byte)(x.pointer), true
 }
 
+func (x Value) AsMap() (m *Map, ok bool) {
+	if x.scalar != mapType || isKnown(x.pointer) {
+		return nil, false
+	}
+	return (*Map)(x.pointer), true
+}
+
+func (x Value) AsError() (exc *Exception, ok bool) {
+	if x.scalar != errorType || isKnown(x.pointer) {
+		return nil, false
+	}
+	return (*Exception)(x.pointer), true
+}
+
 func (x Value) AsCustom() (cv CustomValue, ok bool) {
 	if x.scalar != customType || isKnown(x.pointer) {
 		return nil, false
@@ -266,7 +368,7 @@ func (x Value) Allocate() *Value {
 
 func isKnown(p unsafe.Pointer) bool {
 	switch p {
-	case nil, f64Type, boolType:
+	case nil, i64Type, f64Type, boolType:
 		return true
 	}
 	return false
@@ -278,6 +380,8 @@ func (x Value) IsTruthy() bool {
 		return false
 	case boolType:
 		return x.scalar != 0
+	case i64Type:
+		return x.scalar != 0
 	case f64Type:
 		return math.Float64frombits(x.scalar) != 0
 	}
@@ -292,14 +396,17 @@ func (x Value) IsTruthy() bool {
 		array := *(*[]Value)(x.pointer)
 		return len(array) != 0
 	case taskType:
-		task := *(*chan evaluation)(x.pointer)
-		return len(task) != 0
+		return len((*task)(x.pointer).done) != 0
 	case bufferType:
 		array := *(*[]Value)(x.pointer)
 		return len(array) != 0
 	case customType:
 		cv := *(*CustomValue)(x.pointer)
 		return cv.IsTruthy()
+	case mapType:
+		return (*Map)(x.pointer).Len() != 0
+	case errorType, generatorType, recordType, enumType:
+		return true
 	}
 
 	return false
@@ -310,9 +417,10 @@ func (x Value) Equals(y Value) bool {
 	case nil:
 		return y.pointer == nil
 	case boolType:
-		return x.scalar == y.scalar
-	case f64Type:
-		return math.Float64frombits(x.scalar) == math.Float64frombits(y.scalar)
+		return y.pointer == boolType && x.scalar == y.scalar
+	case i64Type, f64Type:
+		// integers & floats are equal if they are the same number e.g. 1 == 1.0
+		return x.numEquals(y)
 	}
 
 	// guarantees that their types are the same beyond this point
@@ -327,13 +435,20 @@ func (x Value) Equals(y Value) bool {
 		lhs := (*(*CustomValue)(x.pointer))
 		rhs := (*(*CustomValue)(y.pointer))
 		return lhs.Equals(rhs)
+	case recordType:
+		return (*Record)(x.pointer).equals((*Record)(y.pointer))
 	}
 
-	// default comparison
+	// default comparison; arrays, maps and enum members are equal only to themselves
 	return x.pointer == y.pointer
 }
 
 func (x Value) String() string {
+	return x.format(nil)
+}
+
+// format is String, seen holds the arrays, maps & records being printed further up so a cycle is cut short
+func (x Value) format(seen []unsafe.Pointer) string {
 	switch x.pointer {
 	case nil:
 		return "nil"
@@ -342,6 +457,8 @@ func (x Value) String() string {
 			return "false"
 		}
 		return "true"
+	case i64Type:
+		return strconv.FormatInt(int64(x.scalar), 10)
 	case f64Type:
 		return strconv.FormatFloat(math.Float64frombits(x.scalar), 'f', -1, 64)
 	}
@@ -354,20 +471,17 @@ func (x Value) String() string {
 	case goFuncType:
 		return "<function>"
 	case arrayType:
+		if slices.Contains(seen, x.pointer) {
+			return "[...]"
+		}
+		seen = append(seen, x.pointer)
 		array := *(*[]Value)(x.pointer)
 
 		builder := strings.Builder{}
 		builder.WriteByte('[')
 
 		for i, v := range array {
-			if str, ok := v.AsString(); ok {
-				builder.WriteByte('"')
-				builder.WriteString(str)
-				builder.WriteByte('"')
-			} else {
-				builder.WriteString(v.String())
-			}
-
+			writeElement(&builder, v, seen)
 			if i != len(array)-1 {
 				builder.WriteString(", ")
 			}
@@ -387,25 +501,48 @@ func (x Value) String() string {
 	case customType:
 		cv := (*(*CustomValue)(x.pointer))
 		return cv.String()
+	case mapType:
+		return (*Map)(x.pointer).format(seen)
+	case errorType:
+		return (*Exception)(x.pointer).Error()
+	case generatorType:
+		return "<generator>"
+	case recordType:
+		return (*Record)(x.pointer).format(seen)
+	case enumType:
+		return (*enumMember)(x.pointer).String()
 	}
 
 	return "<unknown>"
 }
 
+// writeElement writes v as an element of an array, map or record, quoting strings
+func writeElement(builder *strings.Builder, v Value, seen []unsafe.Pointer) {
+	if str, ok := v.AsString(); ok {
+		builder.WriteByte('"')
+		builder.WriteString(str)
+		builder.WriteByte('"')
+		return
+	}
+	builder.WriteString(v.format(seen))
+}
+
 func (x Value) TypeOf() string {
 	switch x.pointer {
 	case nil:
 		return "nil"
 	case boolType:
 		return "bool"
+	case i64Type:
+		return "int"
 	case f64Type:
-		return "number"
+		return "float"
 	}
 
 	switch x.scalar {
 	case stringType:
 		return "string"
-	case userFnType:
+	case userFnType, goFuncType:
 		return "function"
 	case arrayType:
 		return "array"
@@ -420,6 +557,16 @@ func (x Value) TypeOf() string {
 	case customType:
 		cv := (*(*CustomValue)(x.pointer))
 		return cv.TypeOf()
+	case mapType:
+		return "map"
+	case errorType:
+		return "error"
+	case generatorType:
+		return "generator"
+	case recordType:
+		return (*Record)(x.pointer).typ.name
+	case enumType:
+		return (*enumMember)(x.pointer).enum.name
 	}
 
 	return "<unknown>"
@@ -435,6 +582,8 @@ func (x Value) TypeID() unsafe.Pointer {
 		return strTypeID
 	case arrayType:
 		return arrayTypeID
+	case mapType:
+		return mapTypeID
 	case packageType:
 		return x.pointer
 	}
@@ -473,11 +622,116 @@ func (x Value) getField(f fields.ID) (field Value, ok bool) {
 			return Value{}, false
 		}
 		return *(value.Value), exists
+
+	case mapType:
+		// entries shadow methods & missing keys read as nil
+		if value, exists := (*Map)(x.pointer).Get(fields.Name(f)); exists {
+			return value, true
+		}
+
+		if value, exists := mapMethods[f]; exists {
+			m := Method{this: x, fn: *value}
+			return boxMethod(m), true
+		}
+		return Value{}, true
+
+	case taskType:
+		value, exists := taskMethods[f]
+		if !exists {
+			return Value{}, false
+		}
+
+		m := Method{this: x, fn: *value}
+		return boxMethod(m), true
+
+	case generatorType:
+		value, exists := generatorMethods[f]
+		if !exists {
+			return Value{}, false
+		}
+
+		m := Method{this: x, fn: *value}
+		return boxMethod(m), true
+
+	case errorType:
+		value, exists := errorMethods[f]
+		if !exists {
+			return Value{}, false
+		}
+
+		m := Method{this: x, fn: *value}
+		return boxMethod(m), true
+
+	case enumType:
+		value, exists := enumMethods[f]
+		if !exists {
+			return Value{}, false
+		}
+
+		m := Method{this: x, fn: *value}
+		return boxMethod(m), true
+
+	case recordType:
+		r := (*Record)(x.pointer)
+		if i, exists := r.typ.index[f]; exists {
+			return r.values[i], true
+		}
+
+		value, exists := r.typ.methods[f]
+		if !exists {
+			return Value{}, false
+		}
+
+		m := Method{this: x, fn: *value}
+		return boxMethod(m), true
+
+	case goFuncType:
+		value, exists := (*GoFunc)(x.pointer).members[f]
+		if !exists {
+			return Value{}, false
+		}
+		return *value, true
 	}
 
 	return Value{}, false
 }
 
+func (x Value) setField(f fields.ID, v Value) *Exception {
+	if !isKnown(x.pointer) {
+		switch x.scalar {
+		case mapType:
+			(*Map)(x.pointer).Set(fields.Name(f), v)
+			return nil
+
+		case packageType:
+			pkg := (*packageInstance)(x.pointer)
+			field, exists := pkg.globals[f]
+			if !exists || !field.IsPublic {
+				return TypeErrorF("Symbol '%s' not found in package '%s'.", fields.Name(f), pkg.name)
+			}
+
+			if field.IsStatic {
+				return TypeErrorF("Assignment to constant symbol '%v' of package '%v'.", fields.Name(f), pkg.name)
+			}
+
+			*(field.Value) = v
+			return nil
+
+		case recordType:
+			r := (*Record)(x.pointer)
+			i, exists := r.typ.index[f]
+			if !exists {
+				return TypeErrorF("type '%v' has no field '%v'", r.typ.name, fields.Name(f))
+			}
+
+			r.values[i] = v
+			return nil
+		}
+	}
+
+	return TypeErrorF("cannot set field '%v' on a value of type '%v'", fields.Name(f), x.TypeOf())
+}
+
 func (x Value) dotAccess(f fields.ID) (field *Value) {
 	if isKnown(x.pointer) {
 		return nil
@@ -488,6 +742,18 @@ func (x Value) dotAccess(f fields.ID) (field *Value) {
 		return stringMethods[f]
 	case arrayType:
 		return arrayMethods[f]
+	case mapType:
+		return mapMethods[f]
+	case errorType:
+		return errorMethods[f]
+	case taskType:
+		return taskMethods[f]
+	case generatorType:
+		return generatorMethods[f]
+	case recordType:
+		return (*Record)(x.pointer).typ.methods[f]
+	case enumType:
+		return enumMethods[f]
 	case packageType:
 		pkg := (*packageInstance)(x.pointer)
 		value := pkg.globals[f]
@@ -499,3 +765,96 @@ func (x Value) dotAccess(f fields.ID) (field *Value) {
 
 	panic("add more types?")
 }
+
+// toIndex converts an evie number into a Go index, negative indices count from the back
+func toIndex(i Value, length int) (int, *Exception) {
+	n, ok := i.AsInt64()
+	if !ok {
+		// whole floats still work e.g. arr[n / 2.0]
+		f, isFloat := i.AsFloat64()
+		if n, ok = wholeInt(f); !isFloat || !ok {
+			return 0, TypeErrorF("index must be a whole number, got '%v'", i)
+		}
+	}
+
+	index := n
+	if index < 0 {
+		index += int64(length)
+	}
+
+	if index < 0 || index >= int64(length) {
+		return 0, indexError(int(n), length)
+	}
+	return int(index), nil
+}
+
+func (x Value) index(i Value) (Value, *Exception) {
+	if !isKnown(x.pointer) {
+		switch x.scalar {
+		case arrayType:
+			array := *(*[]Value)(x.pointer)
+			index, exc := toIndex(i, len(array))
+			if exc != nil {
+				return Value{}, exc
+			}
+			return array[index], nil
+
+		case bufferType:
+			buffer := *(*[]byte)(x.pointer)
+			index, exc := toIndex(i, len(buffer))
+			if exc != nil {
+				return Value{}, exc
+			}
+			return BoxInt(int64(buffer[index])), nil
+
+		case mapType:
+			key, ok := i.AsString()
+			if !ok {
+				return Value{}, TypeErrorF("map keys must be strings, got '%v'", i.TypeOf())
+			}
+			value, _ := (*Map)(x.pointer).Get(key)
+			return value, nil
+		}
+	}
+
+	return Value{}, TypeErrorF("cannot index a value of type '%v'", x.TypeOf())
+}
+
+func (x Value) setIndex(i Value, v Value) *Exception {
+	if !isKnown(x.pointer) {
+		switch x.scalar {
+		case arrayType:
+			array := *(*[]Value)(x.pointer)
+			index, exc := toIndex(i, len(array))
+			if exc != nil {
+				return exc
+			}
+			array[index] = v
+			return nil
+
+		case bufferType:
+			buffer := *(*[]byte)(x.pointer)
+			index, exc := toIndex(i, len(buffer))
+			if exc != nil {
+				return exc
+			}
+
+			b, ok := v.AsFloat64()
+			if !ok || b != math.Trunc(b) || b < 0 || b > 255 {
+				return TypeErrorF("cannot store '%v' in a buffer", v)
+			}
+			buffer[index] = byte(b)
+			return nil
+
+		case mapType:
+			key, ok := i.AsString()
+			if !ok {
+				return TypeErrorF("map keys must be strings, got '%v'", i.TypeOf())
+			}
+			(*Map)(x.pointer).Set(key, v)
+			return nil
+		}
+	}
+
+	return TypeErrorF("cannot index a value of type '%v'", x.TypeOf())
+}